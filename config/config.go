@@ -2,24 +2,475 @@ package config
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joomcode/errorx"
+	"github.com/mitchellh/mapstructure"
+	"github.com/rs/zerolog"
 	"github.com/sovamorco/gommon/config"
 )
 
+const (
+	NoiseReductionLow     = "low"
+	NoiseReductionDefault = "default"
+	NoiseReductionHigh    = "high"
+
+	CurveLinear = "linear"
+	CurveCubic  = "cubic"
+	CurveLog    = "log"
+	CurveCustom = "custom"
+
+	FilterNone   = "none"
+	FilterEMA    = "ema"
+	FilterMedian = "median"
+
+	// DefaultFilterAlpha is the weight of a new reading in the exponential moving average.
+	DefaultFilterAlpha = 0.3
+	// DefaultFilterWindow is the number of readings the median is taken of.
+	DefaultFilterWindow = 5
+
+	// DefaultCurveDB is the range of the log curve, the bottom of the slider is muted regardless.
+	DefaultCurveDB = 60
+
+	// DefaultEncoderStep is the volume change per encoder detent.
+	DefaultEncoderStep = 0.02
+
+	ActionMuteSlider        = "mute_slider"
+	ActionMuteMic           = "mute_mic"
+	ActionToggleDefaultSink = "toggle_default_sink"
+
+	FocusProviderAuto     = "auto"
+	FocusProviderNone     = "none"
+	FocusProviderX11      = "x11"
+	FocusProviderSway     = "sway"
+	FocusProviderHyprland = "hyprland"
+	FocusProviderKWin     = "kwin"
+)
+
+// legacyKeys maps keys of the upstream deej schema to their current names.
+//
+//nolint:gochecknoglobals // constant mapping.
+var legacyKeys = map[string]string{
+	"com_port": "serial_port",
+}
+
 type Config struct {
 	SliderMapping [][]string `mapstructure:"slider_mapping"`
 	SerialPort    string     `mapstructure:"serial_port"`
 	BaudRate      int        `mapstructure:"baud_rate"`
+	// ADCMax is the largest value the board reads, 0 to take it from the handshake or use 1023.
+	ADCMax float64 `mapstructure:"adc_max"`
+
+	// matchers selecting the board when serial_port is "auto".
+	USBVID     string `mapstructure:"usb_vid"`
+	USBPID     string `mapstructure:"usb_pid"`
+	USBSerial  string `mapstructure:"usb_serial"`
+	SerialByID string `mapstructure:"serial_by_id"`
+
+	InvertSliders  bool   `mapstructure:"invert_sliders"`
+	NoiseReduction string `mapstructure:"noise_reduction"`
+	Curve          `mapstructure:",squash"`
+	Filter         `mapstructure:",squash"`
+
+	// MinWriteInterval is the least time between volume changes of a slider, readings in between are coalesced.
+	MinWriteInterval time.Duration `mapstructure:"min_write_interval"`
+
+	// Sliders holds per-slider overrides of the global settings by slider index.
+	Sliders map[int]SliderConfig `mapstructure:"sliders"`
+
+	// Buttons holds actions of hardware buttons by button index.
+	Buttons map[int]ButtonConfig `mapstructure:"buttons"`
+
+	// Encoders holds targets and settings of rotary encoders by encoder index.
+	Encoders map[int]EncoderConfig `mapstructure:"encoders"`
+
+	// FocusProvider finds the focused window for deej.current, FocusProviderAuto if unset.
+	FocusProvider string `mapstructure:"focus_provider"`
 }
 
+type SliderConfig struct {
+	Invert         *bool  `mapstructure:"invert"`
+	NoiseReduction string `mapstructure:"noise_reduction"`
+	Curve          `mapstructure:",squash"`
+	Filter         `mapstructure:",squash"`
+
+	// MinVolume and MaxVolume limit the volume the slider sets, its whole travel is spread between them.
+	MinVolume float64  `mapstructure:"min_volume"`
+	MaxVolume *float64 `mapstructure:"max_volume"`
+	// DeadZoneLow and DeadZoneHigh are fractions of the travel at the ends that snap to the minimum and maximum.
+	DeadZoneLow  float64 `mapstructure:"dead_zone_low"`
+	DeadZoneHigh float64 `mapstructure:"dead_zone_high"`
+}
+
+// Filter smooths the readings of a slider.
+type Filter struct {
+	Filter string `mapstructure:"filter"`
+	// Alpha is the weight of a new reading for FilterEMA.
+	Alpha float64 `mapstructure:"filter_alpha"`
+	// Window is the number of readings for FilterMedian.
+	Window int `mapstructure:"filter_window"`
+}
+
+// Curve maps slider positions to volumes.
+type Curve struct {
+	Curve string `mapstructure:"curve"`
+	// DB is the range of CurveLog in decibels.
+	DB float64 `mapstructure:"curve_db"`
+	// Points are [position, volume] pairs of CurveCustom with increasing positions, interpolated linearly.
+	Points [][]float64 `mapstructure:"curve_points"`
+}
+
+// ButtonConfig is the action triggered by pressing a button.
+type ButtonConfig struct {
+	Action string `mapstructure:"action"`
+	// Slider is the index of the slider whose targets are toggled by ActionMuteSlider.
+	Slider *int `mapstructure:"slider"`
+	// Sinks are names or descriptions of sinks ActionToggleDefaultSink cycles through, all sinks if empty.
+	Sinks []string `mapstructure:"sinks"`
+}
+
+type EncoderConfig struct {
+	Targets []string `mapstructure:"targets"`
+	// Step is the volume change per detent, DefaultEncoderStep if unset.
+	Step float64 `mapstructure:"step"`
+	// Acceleration multiplies steps turned in quick succession, 1 if unset.
+	Acceleration float64 `mapstructure:"acceleration"`
+	// PushToMute toggles mute on the targets when the encoder is pushed.
+	PushToMute bool `mapstructure:"push_to_mute"`
+}
+
+// Load reads and validates the config. If it is invalid, the returned error wraps a *ValidationError
+// listing every problem found.
 func Load(ctx context.Context, filename string) (*Config, error) {
-	var c Config
+	logger := zerolog.Ctx(ctx)
+
+	var raw map[string]any
 
-	err := config.LoadConfig(ctx, filename, &c)
+	err := config.LoadConfig(ctx, filename, &raw)
 	if err != nil {
 		return nil, errorx.Decorate(err, "load config")
 	}
 
+	legacy := renameLegacyKeys(raw)
+	if len(legacy) > 0 {
+		logger.Warn().Strs("keys", legacy).Msg("Config uses deprecated keys, see config_example.yaml for current ones")
+	}
+
+	var problems problems
+
+	if mapping, ok := raw["slider_mapping"]; ok {
+		raw["slider_mapping"] = normalizeMapping(&problems, mapping)
+	}
+
+	c, err := decode(&problems, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	c.validate(&problems)
+
+	if len(problems) > 0 {
+		slices.SortStableFunc(problems, func(a, b Problem) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+
+		return nil, errorx.Decorate(&ValidationError{Problems: problems}, "validate config")
+	}
+
+	return c, nil
+}
+
+// LogError logs err returned by Load with msg, listing the problems of an invalid config one per line.
+func LogError(ctx context.Context, filename, msg string, err error) {
+	logger := zerolog.Ctx(ctx)
+
+	var verr *ValidationError
+
+	if !errors.As(err, &verr) {
+		logger.Error().Err(err).Str("filename", filename).Msg(msg)
+
+		return
+	}
+
+	logger.Error().Str("filename", filename).Int("problems", len(verr.Problems)).Msg(msg)
+
+	for _, problem := range verr.Problems {
+		logger.Error().Msg("  " + problem.String())
+	}
+}
+
+func decode(p *problems, raw map[string]any) (*Config, error) {
+	var (
+		c  Config
+		md mapstructure.Metadata
+	)
+
+	//nolint:exhaustruct
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(scalarToList, mapstructure.StringToTimeDurationHookFunc()),
+		Metadata:   &md,
+		Result:     &c,
+	})
+	if err != nil {
+		return nil, errorx.Decorate(err, "create decoder")
+	}
+
+	err = dec.Decode(raw)
+
+	var merr *mapstructure.Error
+
+	switch {
+	case errors.As(err, &merr):
+		for _, msg := range merr.Errors {
+			p.add("", "%s", msg)
+		}
+	case err != nil:
+		return nil, errorx.Decorate(err, "decode config")
+	}
+
+	for _, key := range md.Unused {
+		p.add(key, "unknown key")
+	}
+
 	return &c, nil
 }
+
+// scalarToList accepts a single value where a list of strings is expected, like slider_mapping does.
+func scalarToList(_, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeOf([]string{}) || !isScalar(data) {
+		return data, nil
+	}
+
+	return []string{fmt.Sprint(data)}, nil
+}
+
+// renameLegacyKeys moves values of legacy keys to their current names, unless those are set too.
+// Returns the legacy keys that were found.
+func renameLegacyKeys(raw map[string]any) []string {
+	found := make([]string, 0)
+
+	for legacy, current := range legacyKeys {
+		v, ok := raw[legacy]
+		if !ok {
+			continue
+		}
+
+		found = append(found, legacy)
+
+		if _, ok := raw[current]; !ok {
+			raw[current] = v
+		}
+
+		delete(raw, legacy)
+	}
+
+	slices.Sort(found)
+
+	return found
+}
+
+// normalizeMapping turns both the index-keyed map of upstream deej and a list into [][]string,
+// accepting either a single target or a list of targets per slider. Missing indexes are left empty.
+func normalizeMapping(p *problems, mapping any) [][]string {
+	switch m := mapping.(type) {
+	case nil:
+		return [][]string{}
+	case []any:
+		res := make([][]string, len(m))
+
+		for i, targets := range m {
+			res[i] = normalizeTargets(p, fmt.Sprintf("slider_mapping[%d]", i), targets)
+		}
+
+		return res
+	case map[any]any:
+		return normalizeIndexedMapping(p, m)
+	case map[string]any:
+		indexed := make(map[any]any, len(m))
+
+		for k, v := range m {
+			indexed[k] = v
+		}
+
+		return normalizeIndexedMapping(p, indexed)
+	default:
+		p.add("slider_mapping", "expected a list or a map, got %T", mapping)
+
+		return [][]string{}
+	}
+}
+
+func normalizeIndexedMapping(p *problems, m map[any]any) [][]string {
+	byIndex := make(map[int][]string, len(m))
+	size := 0
+
+	for k, targets := range m {
+		idx, ok := mappingIndex(p, k)
+		if !ok {
+			continue
+		}
+
+		byIndex[idx] = normalizeTargets(p, fmt.Sprintf("slider_mapping[%d]", idx), targets)
+
+		size = max(size, idx+1)
+	}
+
+	res := make([][]string, size)
+
+	for i := range res {
+		res[i] = byIndex[i]
+
+		if res[i] == nil {
+			res[i] = []string{}
+		}
+	}
+
+	return res
+}
+
+func mappingIndex(p *problems, k any) (int, bool) {
+	var idx int
+
+	switch kv := k.(type) {
+	case int:
+		idx = kv
+	case string:
+		var err error
+
+		idx, err = strconv.Atoi(kv)
+		if err != nil {
+			p.add(fmt.Sprintf("slider_mapping[%s]", kv), "key is not a slider index")
+
+			return 0, false
+		}
+	default:
+		p.add(fmt.Sprintf("slider_mapping[%v]", k), "key is not a slider index")
+
+		return 0, false
+	}
+
+	if idx < 0 {
+		p.add(fmt.Sprintf("slider_mapping[%d]", idx), "slider index is negative")
+
+		return 0, false
+	}
+
+	return idx, true
+}
+
+// normalizeTargets keeps empty targets, so that they are reported by validation.
+func normalizeTargets(p *problems, path string, targets any) []string {
+	switch t := targets.(type) {
+	case nil:
+		return []string{}
+	case []any:
+		res := make([]string, 0, len(t))
+
+		for i, target := range t {
+			switch {
+			case target == nil:
+				res = append(res, "")
+			case isScalar(target):
+				res = append(res, fmt.Sprint(target))
+			default:
+				p.add(fmt.Sprintf("%s[%d]", path, i), "expected a target name, got %T", target)
+			}
+		}
+
+		return res
+	default:
+		if isScalar(t) {
+			return []string{fmt.Sprint(t)}
+		}
+
+		p.add(path, "expected a target name or a list of them, got %T", targets)
+
+		return []string{}
+	}
+}
+
+// isScalar reports whether v can be used as a target name,
+// process names like "123" are parsed as numbers by yaml.
+func isScalar(v any) bool {
+	switch v.(type) {
+	case string, int, float64, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// Slider returns settings of the slider at idx, falling back to the global ones where it does not override them.
+func (c *Config) Slider(idx int) SliderConfig {
+	sc := c.Sliders[idx]
+
+	if sc.Invert == nil {
+		invert := c.InvertSliders
+		sc.Invert = &invert
+	}
+
+	if sc.NoiseReduction == "" {
+		sc.NoiseReduction = c.NoiseReduction
+	}
+
+	if sc.NoiseReduction == "" {
+		sc.NoiseReduction = NoiseReductionDefault
+	}
+
+	if sc.Filter.Filter == "" {
+		sc.Filter = c.Filter
+	}
+
+	if sc.Filter.Filter == "" {
+		sc.Filter.Filter = FilterNone
+	}
+
+	if sc.Alpha == 0 {
+		sc.Alpha = DefaultFilterAlpha
+	}
+
+	if sc.Window == 0 {
+		sc.Window = DefaultFilterWindow
+	}
+
+	if sc.MaxVolume == nil {
+		maxVolume := 1.0
+		sc.MaxVolume = &maxVolume
+	}
+
+	// curve settings only make sense together, so they are not mixed with the global ones.
+	if sc.Curve.Curve == "" {
+		sc.Curve = c.Curve
+	}
+
+	if sc.Curve.Curve == "" {
+		sc.Curve.Curve = CurveLinear
+	}
+
+	if sc.DB == 0 {
+		sc.DB = DefaultCurveDB
+	}
+
+	return sc
+}
+
+// Encoder returns settings of the encoder at idx with defaults filled in.
+func (c *Config) Encoder(idx int) EncoderConfig {
+	ec := c.Encoders[idx]
+
+	if ec.Step == 0 {
+		ec.Step = DefaultEncoderStep
+	}
+
+	if ec.Acceleration == 0 {
+		ec.Acceleration = 1
+	}
+
+	return ec
+}
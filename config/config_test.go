@@ -0,0 +1,140 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func load(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(filename, []byte(yaml), 0o600)
+	if err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	return Load(context.Background(), filename)
+}
+
+func TestLoadExample(t *testing.T) {
+	c, err := Load(context.Background(), filepath.Join("..", "config_example.yaml"))
+	if err != nil {
+		t.Fatalf("load example: %v", err)
+	}
+
+	expected := [][]string{
+		{"master"}, {"chrome.exe"}, {"spotify.exe"}, {"pathofexile_x64.exe", "rocketleague.exe"}, {"discord.exe"},
+	}
+
+	if !reflect.DeepEqual(c.SliderMapping, expected) {
+		t.Errorf("expected mapping %v, got %v", expected, c.SliderMapping)
+	}
+}
+
+// TestLoadUpstream loads a config of upstream deej, with com_port and slider indexes as keys.
+func TestLoadUpstream(t *testing.T) {
+	c, err := load(t, `
+slider_mapping:
+  0: master
+  2:
+    - spotify.exe
+    - 1234
+invert_sliders: false
+com_port: /dev/ttyACM0
+baud_rate: 9600
+noise_reduction: default
+`)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if c.SerialPort != "/dev/ttyACM0" {
+		t.Errorf("expected com_port as serial_port, got %q", c.SerialPort)
+	}
+
+	// missing indexes are left empty, numeric process names are kept.
+	expected := [][]string{{"master"}, {}, {"spotify.exe", "1234"}}
+
+	if !reflect.DeepEqual(c.SliderMapping, expected) {
+		t.Errorf("expected mapping %v, got %v", expected, c.SliderMapping)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		paths []string
+	}{
+		{
+			name: "mapping",
+			yaml: `
+serial_port: /dev/ttyUSB0
+baud_rate: 9600
+slider_mapping:
+  0: master
+  x: spotify
+  -1: discord
+  2: ["", {a: b}]
+  3: "re:[a"
+`,
+			paths: []string{
+				"slider_mapping[-1]", "slider_mapping[2][0]", "slider_mapping[2][1]", "slider_mapping[3][0]", "slider_mapping[x]",
+			},
+		},
+		{
+			name: "settings",
+			yaml: `
+baud_rate: 0
+slider_mapping: [master]
+unknown_key: 1
+`,
+			paths: []string{"baud_rate", "serial_port", "unknown_key"},
+		},
+		{
+			name: "sliders and encoders",
+			yaml: `
+serial_port: /dev/ttyUSB0
+baud_rate: 9600
+slider_mapping: [master]
+sliders:
+  3:
+    invert: true
+encoders:
+  0:
+    targets: ["tree:name:x"]
+    step: 2
+  1:
+    step: 0.1
+`,
+			paths: []string{"encoders[0].step", "encoders[0].targets[0]", "encoders[1].targets", "sliders[3]"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := load(t, test.yaml)
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+
+			paths := make([]string, len(verr.Problems))
+
+			for i, p := range verr.Problems {
+				paths[i] = p.Path
+			}
+
+			if !reflect.DeepEqual(paths, test.paths) {
+				t.Errorf("expected problems at %v, got %v", test.paths, verr.Problems)
+			}
+		})
+	}
+}
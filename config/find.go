@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/joomcode/errorx"
+)
+
+const (
+	envConfig = "DEEJ_CONFIG"
+
+	configName = "config.yaml"
+	systemDir  = "/etc/deej"
+)
+
+// Find returns the config file to use: explicit if set, then $DEEJ_CONFIG,
+// then the first existing one of $XDG_CONFIG_HOME/deej/config.yaml, /etc/deej/config.yaml and ./config.yaml.
+func Find(explicit string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+
+	if env := os.Getenv(envConfig); env != "" {
+		return env, nil
+	}
+
+	candidates := make([]string, 0)
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "deej", configName))
+	}
+
+	candidates = append(candidates, filepath.Join(systemDir, configName), configName)
+
+	for _, candidate := range candidates {
+		_, err := os.Stat(candidate)
+		if err == nil {
+			return candidate, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", errorx.Decorate(err, "stat %s", candidate)
+		}
+	}
+
+	return "", errorx.IllegalState.New("no config file found, searched %v", candidates)
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/joomcode/errorx"
+)
+
+const (
+	TargetMaster   = "master"
+	TargetMic      = "mic"
+	TargetUnmapped = "deej.unmapped"
+	TargetCurrent  = "deej.current"
+	// TargetInputPrefix targets capture streams of a process, i.e. "mic:discord".
+	TargetInputPrefix = "mic:"
+
+	matchGlobPrefix  = "glob:"
+	matchRegexPrefix = "re:"
+	// prefix for matching the processes a stream was started from as well, i.e. "tree:steam".
+	matchTreePrefix = "tree:"
+)
+
+// aliases are short selectors for common properties.
+//
+//nolint:gochecknoglobals // constant mapping.
+var aliases = map[string]string{
+	"name":   "application.name",
+	"binary": "application.process.binary",
+	// roles are set by apps, i.e. Music, Movie, Game, Communication or Notification.
+	"role": "media.role",
+}
+
+type TargetKind int
+
+const (
+	TargetStreams TargetKind = iota
+	TargetInputs
+	TargetMasterDevice
+	TargetMicDevice
+	TargetUnmappedStreams
+	TargetCurrentStreams
+)
+
+// Target selects the nodes controlled by a slider, encoder or button.
+type Target struct {
+	Raw  string
+	Kind TargetKind
+	// Pattern selects streams and devices for TargetStreams and streams for TargetInputs, nil otherwise.
+	Pattern *Pattern
+}
+
+// Pattern matches nodes by a case-insensitive literal, a "glob:" pattern or a "re:" regex,
+// comparing their binary, or the property picked by a selector, i.e. "media.role:Music".
+// Selectors are property names, which always contain a dot, or one of aliases.
+// Prefixed with "tree:", a pattern also matches streams of processes descending from a matching process,
+// like game processes started by steam.
+type Pattern struct {
+	raw string
+
+	// Property is the compared property, empty to compare the binary of streams and the name or description of devices.
+	Property string
+	// Tree makes the pattern compare the names of the ancestors of streams too.
+	Tree bool
+
+	literal string
+	glob    string
+	re      *regexp.Regexp
+}
+
+// ParseTarget parses a target of slider_mapping or an encoder.
+func ParseTarget(raw string) (Target, error) {
+	switch {
+	case raw == TargetMaster:
+		return Target{Raw: raw, Kind: TargetMasterDevice, Pattern: nil}, nil
+	case raw == TargetMic:
+		return Target{Raw: raw, Kind: TargetMicDevice, Pattern: nil}, nil
+	case raw == TargetUnmapped:
+		return Target{Raw: raw, Kind: TargetUnmappedStreams, Pattern: nil}, nil
+	case raw == TargetCurrent:
+		return Target{Raw: raw, Kind: TargetCurrentStreams, Pattern: nil}, nil
+	case strings.HasPrefix(raw, TargetInputPrefix):
+		p, err := parsePattern(strings.TrimPrefix(raw, TargetInputPrefix))
+		if err != nil {
+			return Target{}, err
+		}
+
+		return Target{Raw: raw, Kind: TargetInputs, Pattern: p}, nil
+	default:
+		p, err := parsePattern(raw)
+		if err != nil {
+			return Target{}, err
+		}
+
+		return Target{Raw: raw, Kind: TargetStreams, Pattern: p}, nil
+	}
+}
+
+func parsePattern(raw string) (*Pattern, error) {
+	p := &Pattern{
+		raw: raw,
+
+		Property: "",
+		Tree:     false,
+
+		literal: "",
+		glob:    "",
+		re:      nil,
+	}
+
+	pattern := raw
+
+	if rest, ok := strings.CutPrefix(pattern, matchTreePrefix); ok {
+		p.Tree = true
+		pattern = rest
+	}
+
+	if selector, rest, ok := strings.Cut(pattern, ":"); ok {
+		if property, ok := aliases[selector]; ok {
+			p.Property = property
+			pattern = rest
+		} else if strings.Contains(selector, ".") {
+			p.Property = selector
+			pattern = rest
+		}
+	}
+
+	if p.Tree && p.Property != "" {
+		return nil, errorx.IllegalArgument.New("%q selects a property, %s only matches process names", raw, matchTreePrefix)
+	}
+
+	switch {
+	case strings.HasPrefix(pattern, matchGlobPrefix):
+		p.glob = strings.ToLower(strings.TrimPrefix(pattern, matchGlobPrefix))
+
+		if _, err := path.Match(p.glob, ""); err != nil {
+			return nil, errorx.Decorate(err, "invalid glob in %q", raw)
+		}
+	case strings.HasPrefix(pattern, matchRegexPrefix):
+		expr := strings.TrimPrefix(pattern, matchRegexPrefix)
+
+		// compiled as written first, so that errors quote the regex of the user.
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, errorx.Decorate(err, "invalid regex in %q", raw)
+		}
+
+		// names are case-insensitive, like literals and globs.
+		p.re = regexp.MustCompile("(?i)" + expr)
+	default:
+		p.literal = strings.ToLower(pattern)
+	}
+
+	return p, nil
+}
+
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// Match reports whether value matches the pattern.
+func (p *Pattern) Match(value string) bool {
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(value)
+	case p.glob != "":
+		ok, _ := path.Match(p.glob, strings.ToLower(value))
+
+		return ok
+	default:
+		return p.literal == strings.ToLower(value)
+	}
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/joomcode/errorx"
+)
+
+// SerialPortAuto makes deej look for the board among attached usb serial ports.
+const SerialPortAuto = "auto"
+
+//nolint:gochecknoglobals // compiled once.
+var usbIDRe = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{4}$`)
+
+// Problem is a single issue found in the config, Path is the key it was found at, i.e. slider_mapping[3][1].
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+
+	return p.Path + ": " + p.Message
+}
+
+// ValidationError holds every problem found in the config.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+
+	return fmt.Sprintf("%d problem(s) found: %s", len(e.Problems), strings.Join(msgs, "; "))
+}
+
+type problems []Problem
+
+func (p *problems) add(path, format string, args ...any) {
+	*p = append(*p, Problem{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *Config) validate(p *problems) {
+	if c.SerialPort == "" {
+		p.add("serial_port", "required")
+	}
+
+	if c.BaudRate <= 0 {
+		p.add("baud_rate", "must be positive, got %d", c.BaudRate)
+	}
+
+	if c.ADCMax < 0 {
+		p.add("adc_max", "must not be negative, got %g", c.ADCMax)
+	}
+
+	c.validateMatchers(p)
+
+	for i, targets := range c.SliderMapping {
+		for j, target := range targets {
+			validateTarget(p, fmt.Sprintf("slider_mapping[%d][%d]", i, j), target)
+		}
+	}
+
+	validateNoiseReduction(p, "noise_reduction", c.NoiseReduction)
+	validateCurve(p, "", c.Curve)
+	validateFilter(p, "", c.Filter)
+
+	if c.MinWriteInterval < 0 {
+		p.add("min_write_interval", "must not be negative, got %s", c.MinWriteInterval)
+	}
+
+	providers := []string{
+		FocusProviderAuto, FocusProviderNone, FocusProviderX11, FocusProviderSway, FocusProviderHyprland, FocusProviderKWin,
+	}
+
+	if c.FocusProvider != "" && !slices.Contains(providers, c.FocusProvider) {
+		p.add("focus_provider", "unknown provider %q, expected one of %s", c.FocusProvider, strings.Join(providers, ", "))
+	}
+
+	for _, idx := range sortedKeys(c.Sliders) {
+		path := fmt.Sprintf("sliders[%d]", idx)
+
+		if idx < 0 || idx >= len(c.SliderMapping) {
+			p.add(path, "no such slider in slider_mapping")
+		}
+
+		validateNoiseReduction(p, path+".noise_reduction", c.Sliders[idx].NoiseReduction)
+		validateCurve(p, path+".", c.Sliders[idx].Curve)
+		validateFilter(p, path+".", c.Sliders[idx].Filter)
+		validateLimits(p, path, c.Sliders[idx])
+	}
+
+	for _, idx := range sortedKeys(c.Buttons) {
+		c.validateButton(p, idx)
+	}
+
+	for _, idx := range sortedKeys(c.Encoders) {
+		c.validateEncoder(p, idx)
+	}
+}
+
+func (c *Config) validateEncoder(p *problems, idx int) {
+	path := fmt.Sprintf("encoders[%d]", idx)
+	encoder := c.Encoders[idx]
+
+	if idx < 0 {
+		p.add(path, "encoder index is negative")
+	}
+
+	if len(encoder.Targets) == 0 {
+		p.add(path+".targets", "required")
+	}
+
+	for i, target := range encoder.Targets {
+		validateTarget(p, fmt.Sprintf("%s.targets[%d]", path, i), target)
+	}
+
+	if encoder.Step < 0 || encoder.Step > 1 {
+		p.add(path+".step", "must be between 0 and 1, got %g", encoder.Step)
+	}
+
+	if encoder.Acceleration != 0 && encoder.Acceleration < 1 {
+		p.add(path+".acceleration", "must be at least 1, got %g", encoder.Acceleration)
+	}
+}
+
+func (c *Config) validateButton(p *problems, idx int) {
+	path := fmt.Sprintf("buttons[%d]", idx)
+	button := c.Buttons[idx]
+
+	if idx < 0 {
+		p.add(path, "button index is negative")
+	}
+
+	actions := []string{ActionMuteSlider, ActionMuteMic, ActionToggleDefaultSink}
+
+	if !slices.Contains(actions, button.Action) {
+		p.add(path+".action", "unknown action %q, expected one of %s", button.Action, strings.Join(actions, ", "))
+	}
+
+	switch {
+	case button.Action == ActionMuteSlider && button.Slider == nil:
+		p.add(path+".slider", "required for %s", ActionMuteSlider)
+	case button.Action == ActionMuteSlider && (*button.Slider < 0 || *button.Slider >= len(c.SliderMapping)):
+		p.add(path+".slider", "no such slider in slider_mapping")
+	case button.Action != ActionMuteSlider && button.Slider != nil:
+		p.add(path+".slider", "only used with %s", ActionMuteSlider)
+	}
+
+	if button.Action != ActionToggleDefaultSink && len(button.Sinks) > 0 {
+		p.add(path+".sinks", "only used with %s", ActionToggleDefaultSink)
+	}
+}
+
+func validateTarget(p *problems, path, target string) {
+	if strings.TrimSpace(target) == "" {
+		p.add(path, "empty target")
+
+		return
+	}
+
+	if _, err := ParseTarget(target); err != nil {
+		p.add(path, "%s", problemMessage(err))
+	}
+}
+
+// problemMessage returns the message of err and its causes without errorx type names, which mean nothing to users.
+func problemMessage(err error) string {
+	e := errorx.Cast(err)
+	if e == nil {
+		return err.Error()
+	}
+
+	if cause := e.Cause(); cause != nil {
+		return e.Message() + ": " + problemMessage(cause)
+	}
+
+	return e.Message()
+}
+
+func (c *Config) validateMatchers(p *problems) {
+	matchers := []struct {
+		key, value string
+		usbID      bool
+	}{
+		{key: "usb_vid", value: c.USBVID, usbID: true},
+		{key: "usb_pid", value: c.USBPID, usbID: true},
+		{key: "usb_serial", value: c.USBSerial, usbID: false},
+		{key: "serial_by_id", value: c.SerialByID, usbID: false},
+	}
+
+	for _, m := range matchers {
+		if m.value == "" {
+			continue
+		}
+
+		if c.SerialPort != SerialPortAuto {
+			p.add(m.key, "only used with serial_port: %s", SerialPortAuto)
+		}
+
+		if m.usbID && !usbIDRe.MatchString(m.value) {
+			p.add(m.key, "expected 4 hexadecimal digits, got %q", m.value)
+		}
+	}
+
+	if _, err := filepath.Match(c.SerialByID, ""); err != nil {
+		p.add("serial_by_id", "invalid pattern: %s", err)
+	}
+}
+
+func validateNoiseReduction(p *problems, path, level string) {
+	levels := []string{NoiseReductionLow, NoiseReductionDefault, NoiseReductionHigh}
+
+	if level != "" && !slices.Contains(levels, level) {
+		p.add(path, "unknown level %q, expected one of %s", level, strings.Join(levels, ", "))
+	}
+}
+
+func validateLimits(p *problems, path string, sc SliderConfig) {
+	maxVolume := 1.0
+	if sc.MaxVolume != nil {
+		maxVolume = *sc.MaxVolume
+	}
+
+	switch {
+	case sc.MinVolume < 0 || sc.MinVolume > 1:
+		p.add(path+".min_volume", "must be between 0 and 1, got %g", sc.MinVolume)
+	case maxVolume < 0 || maxVolume > 1:
+		p.add(path+".max_volume", "must be between 0 and 1, got %g", maxVolume)
+	case sc.MinVolume >= maxVolume:
+		p.add(path+".min_volume", "must be less than max_volume")
+	}
+
+	switch {
+	case sc.DeadZoneLow < 0 || sc.DeadZoneLow >= 1:
+		p.add(path+".dead_zone_low", "must be between 0 and 1, got %g", sc.DeadZoneLow)
+	case sc.DeadZoneHigh < 0 || sc.DeadZoneHigh >= 1:
+		p.add(path+".dead_zone_high", "must be between 0 and 1, got %g", sc.DeadZoneHigh)
+	case sc.DeadZoneLow+sc.DeadZoneHigh >= 1:
+		p.add(path, "dead_zone_low and dead_zone_high leave no travel")
+	}
+}
+
+// validateFilter reports problems under prefix, which is empty for the global filter.
+func validateFilter(p *problems, prefix string, filter Filter) {
+	filters := []string{FilterNone, FilterEMA, FilterMedian}
+
+	if filter.Filter != "" && !slices.Contains(filters, filter.Filter) {
+		p.add(prefix+"filter", "unknown filter %q, expected one of %s", filter.Filter, strings.Join(filters, ", "))
+	}
+
+	switch {
+	case filter.Alpha < 0 || filter.Alpha > 1:
+		p.add(prefix+"filter_alpha", "must be between 0 and 1, got %g", filter.Alpha)
+	case filter.Alpha != 0 && filter.Filter != FilterEMA:
+		p.add(prefix+"filter_alpha", "only used with filter: %s", FilterEMA)
+	}
+
+	switch {
+	case filter.Window < 0:
+		p.add(prefix+"filter_window", "must be positive, got %d", filter.Window)
+	case filter.Window != 0 && filter.Filter != FilterMedian:
+		p.add(prefix+"filter_window", "only used with filter: %s", FilterMedian)
+	}
+}
+
+// validateCurve reports problems under prefix, which is empty for the global curve.
+func validateCurve(p *problems, prefix string, curve Curve) {
+	curves := []string{CurveLinear, CurveCubic, CurveLog, CurveCustom}
+
+	if curve.Curve != "" && !slices.Contains(curves, curve.Curve) {
+		p.add(prefix+"curve", "unknown curve %q, expected one of %s", curve.Curve, strings.Join(curves, ", "))
+	}
+
+	switch {
+	case curve.DB < 0:
+		p.add(prefix+"curve_db", "must be positive, got %g", curve.DB)
+	case curve.DB > 0 && curve.Curve != CurveLog:
+		p.add(prefix+"curve_db", "only used with curve: %s", CurveLog)
+	}
+
+	if curve.Curve != CurveCustom {
+		if len(curve.Points) > 0 {
+			p.add(prefix+"curve_points", "only used with curve: %s", CurveCustom)
+		}
+
+		return
+	}
+
+	if len(curve.Points) < 2 {
+		p.add(prefix+"curve_points", "at least 2 points required, got %d", len(curve.Points))
+	}
+
+	for i, point := range curve.Points {
+		path := fmt.Sprintf("%scurve_points[%d]", prefix, i)
+
+		switch {
+		case len(point) != 2:
+			p.add(path, "expected [position, volume], got %d values", len(point))
+		case point[0] < 0 || point[0] > 1 || point[1] < 0 || point[1] > 1:
+			p.add(path, "position and volume must be between 0 and 1, got %v", point)
+		case i > 0 && len(curve.Points[i-1]) == 2 && point[0] <= curve.Points[i-1][0]:
+			p.add(path, "positions must be increasing")
+		}
+	}
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
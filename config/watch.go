@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// editors tend to write files in several steps, wait for them to settle.
+	reloadDelay = 200 * time.Millisecond
+
+	inotifyBufferSize = 4096
+	// offset of the name length in struct inotify_event.
+	inotifyLenOffset = 12
+	inotifyMask      = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE
+)
+
+// Watch reloads the config whenever filename changes and sends every valid result to the returned channel.
+// Invalid configs are logged and skipped.
+func Watch(ctx context.Context, filename string) (<-chan *Config, error) {
+	// watch the directory, since editors often replace the file instead of writing to it.
+	dir, name := filepath.Split(filepath.Clean(filename))
+	if dir == "" {
+		dir = "."
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, errorx.Decorate(err, "init inotify")
+	}
+
+	// non-blocking descriptors are read through the runtime poller, so closing the file unblocks reads.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	_, err = unix.InotifyAddWatch(fd, dir, inotifyMask)
+	if err != nil {
+		return nil, errorx.Decorate(errors.Join(err, f.Close()), "add watch")
+	}
+
+	changes := make(chan struct{}, 1)
+	configs := make(chan *Config)
+
+	context.AfterFunc(ctx, func() {
+		err := f.Close()
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to close inotify")
+		}
+	})
+
+	go readEvents(ctx, f, name, changes)
+	go reload(ctx, filename, changes, configs)
+
+	return configs, nil
+}
+
+func readEvents(ctx context.Context, f *os.File, name string, changes chan<- struct{}) {
+	logger := zerolog.Ctx(ctx)
+
+	buf := make([]byte, inotifyBufferSize)
+
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error().Err(err).Msg("Failed to read inotify events")
+			}
+
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			nameLen := binary.NativeEndian.Uint32(buf[offset+inotifyLenOffset:])
+
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(nameLen)
+
+			if eventName(buf[nameStart:min(offset, n)]) != name {
+				continue
+			}
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func eventName(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+
+	return string(b)
+}
+
+func reload(ctx context.Context, filename string, changes <-chan struct{}, configs chan<- *Config) {
+	logger := zerolog.Ctx(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reloadDelay):
+		}
+
+		// drop changes that happened while waiting.
+		select {
+		case <-changes:
+		default:
+		}
+
+		c, err := Load(ctx, filename)
+		if err != nil {
+			LogError(ctx, filename, "Failed to reload config, keeping the current one", err)
+
+			continue
+		}
+
+		logger.Info().Str("filename", filename).Msg("Config reloaded")
+
+		select {
+		case <-ctx.Done():
+			return
+		case configs <- c:
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/omriharel/deej/config"
+	"github.com/rs/zerolog"
+)
+
+// how often providers without focus events are asked for the focused window, and Wait is retried after failing.
+const pollInterval = 250 * time.Millisecond
+
+// Provider reports the process owning the focused window.
+type Provider interface {
+	// FocusedPID returns the pid of the process owning the focused window, 0 if no window is focused.
+	FocusedPID(ctx context.Context) (int, error)
+	// Wait blocks until the focused window may have changed or ctx is done.
+	// Providers with focus events return right after subscribing to them, so that no change is missed in between.
+	Wait(ctx context.Context) error
+	Close() error
+}
+
+// providers creates providers by name from the environment.
+//
+//nolint:gochecknoglobals // constant mapping.
+var providers = map[string]func() (Provider, error){
+	config.FocusProviderX11: func() (Provider, error) {
+		return NewX11(os.Getenv("DISPLAY"))
+	},
+	config.FocusProviderSway: func() (Provider, error) {
+		return NewSway(os.Getenv("SWAYSOCK"))
+	},
+	config.FocusProviderHyprland: func() (Provider, error) {
+		return NewHyprland(os.Getenv("HYPRLAND_INSTANCE_SIGNATURE"))
+	},
+	config.FocusProviderKWin: func() (Provider, error) {
+		return NewKWin()
+	},
+}
+
+// New creates the provider with the given name, detecting it from the environment if it is empty
+// or config.FocusProviderAuto. Returns nil for config.FocusProviderNone, or if no provider fits the session.
+func New(name string) (Provider, error) {
+	if name == "" || name == config.FocusProviderAuto {
+		name = detect()
+	}
+
+	if name == config.FocusProviderNone {
+		return nil, nil //nolint:nilnil // no provider is not an error.
+	}
+
+	create, ok := providers[name]
+	if !ok {
+		return nil, errorx.IllegalArgument.New("unknown focus provider %q", name)
+	}
+
+	p, err := create()
+	if err != nil {
+		return nil, errorx.Decorate(err, "create %s focus provider", name)
+	}
+
+	return p, nil
+}
+
+// detect picks the provider for the current session, wayland compositors first,
+// since X11 apps running under them only see their own windows.
+func detect() string {
+	switch {
+	case os.Getenv("SWAYSOCK") != "":
+		return config.FocusProviderSway
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		return config.FocusProviderHyprland
+	case os.Getenv("WAYLAND_DISPLAY") != "" && strings.Contains(os.Getenv("XDG_CURRENT_DESKTOP"), "KDE"):
+		return config.FocusProviderKWin
+	case os.Getenv("DISPLAY") != "":
+		return config.FocusProviderX11
+	default:
+		return config.FocusProviderNone
+	}
+}
+
+// Watch asks p for the focused window whenever it may have changed until ctx is done,
+// and sends the pid of the focused window whenever it changes.
+// The channel is closed and p with it when ctx is done.
+func Watch(ctx context.Context, p Provider) <-chan int {
+	logger := zerolog.Ctx(ctx)
+
+	pids := make(chan int)
+
+	go func() {
+		defer close(pids)
+
+		defer func() {
+			err := p.Close()
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to close focus provider")
+			}
+		}()
+
+		last := -1
+		failing := false
+		waitFailing := false
+
+		for {
+			pid, err := p.FocusedPID(ctx)
+
+			switch {
+			case err != nil && !failing:
+				logger.Warn().Err(err).Msg("Failed to get focused window, retrying")
+
+				failing = true
+			case err == nil && pid != last:
+				failing = false
+				last = pid
+
+				select {
+				case <-ctx.Done():
+					return
+				case pids <- pid:
+				}
+			case err == nil:
+				failing = false
+			}
+
+			err = p.Wait(ctx)
+
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				if !waitFailing {
+					logger.Warn().Err(err).Msg("Failed to wait for focus changes, polling until it works again")
+				}
+
+				waitFailing = true
+
+				if poll(ctx, pollInterval) != nil {
+					return
+				}
+			default:
+				waitFailing = false
+			}
+		}
+	}()
+
+	return pids
+}
+
+// poll waits for interval, it implements Wait for providers without focus events.
+func poll(ctx context.Context, interval time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return errorx.Decorate(ctx.Err(), "poll")
+	case <-time.After(interval):
+		return nil
+	}
+}
+
+// closeConn closes conn, joining a failure to err.
+func closeConn(conn net.Conn, err *error) {
+	closeErr := conn.Close()
+	if closeErr != nil {
+		*err = errors.Join(*err, errorx.Decorate(closeErr, "close connection"))
+	}
+}
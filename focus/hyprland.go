@@ -0,0 +1,142 @@
+package focus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joomcode/errorx"
+)
+
+const (
+	hyprlandActiveWindow = "j/activewindow"
+	// event sent with the address of the focused window, or none, whenever the focus changes.
+	hyprlandActiveWindowEvent = "activewindowv2>>"
+)
+
+// Hyprland reads the focused window from a Hyprland session, asking over its request socket
+// whenever its event socket reports a focus change.
+type Hyprland struct {
+	socket      string
+	eventSocket string
+
+	// connection to the event socket, nil until Wait connects.
+	events       net.Conn
+	eventsReader *bufio.Reader
+}
+
+// NewHyprland creates a provider for the Hyprland instance, which Hyprland exports as HYPRLAND_INSTANCE_SIGNATURE.
+func NewHyprland(signature string) (*Hyprland, error) {
+	if signature == "" {
+		return nil, errorx.IllegalArgument.New("HYPRLAND_INSTANCE_SIGNATURE is not set")
+	}
+
+	// sockets moved to the runtime dir in Hyprland 0.40, older versions keep them in /tmp.
+	dir := filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "hypr", signature)
+	if _, err := os.Stat(filepath.Join(dir, ".socket.sock")); err != nil {
+		dir = filepath.Join("/tmp/hypr", signature)
+	}
+
+	return &Hyprland{
+		socket:      filepath.Join(dir, ".socket.sock"),
+		eventSocket: filepath.Join(dir, ".socket2.sock"),
+
+		events:       nil,
+		eventsReader: nil,
+	}, nil
+}
+
+func (h *Hyprland) FocusedPID(ctx context.Context) (pid int, err error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", h.socket)
+	if err != nil {
+		return 0, errorx.Decorate(err, "connect to %s", h.socket)
+	}
+	defer closeConn(conn, &err)
+
+	_, err = conn.Write([]byte(hyprlandActiveWindow))
+	if err != nil {
+		return 0, errorx.Decorate(err, "write request")
+	}
+
+	// the reply is terminated by closing the connection.
+	payload, err := io.ReadAll(conn)
+	if err != nil {
+		return 0, errorx.Decorate(err, "read reply")
+	}
+
+	// Hyprland replies with an empty object if no window is focused.
+	var window struct {
+		PID int `json:"pid"`
+	}
+
+	err = json.Unmarshal(payload, &window)
+	if err != nil {
+		return 0, errorx.Decorate(err, "decode active window")
+	}
+
+	return max(window.PID, 0), nil
+}
+
+func (h *Hyprland) Wait(ctx context.Context) error {
+	if h.events == nil {
+		var dialer net.Dialer
+
+		conn, err := dialer.DialContext(ctx, "unix", h.eventSocket)
+		if err != nil {
+			return errorx.Decorate(err, "connect to %s", h.eventSocket)
+		}
+
+		h.events = conn
+		h.eventsReader = bufio.NewReader(conn)
+
+		return nil
+	}
+
+	conn := h.events
+
+	stop := context.AfterFunc(ctx, func() {
+		// unblocks the read below, which fails if this does not.
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	for {
+		line, err := h.eventsReader.ReadString('\n')
+		if err != nil {
+			return errorx.Decorate(errors.Join(err, h.close()), "read event")
+		}
+
+		if strings.HasPrefix(line, hyprlandActiveWindowEvent) {
+			return nil
+		}
+	}
+}
+
+func (h *Hyprland) Close() error {
+	return h.close()
+}
+
+func (h *Hyprland) close() error {
+	if h.events == nil {
+		return nil
+	}
+
+	err := h.events.Close()
+	h.events = nil
+	h.eventsReader = nil
+
+	if err != nil {
+		return errorx.Decorate(err, "close event connection")
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/joomcode/errorx"
+)
+
+const (
+	kdotool = "kdotool"
+	// every query starts kdotool, which loads a script into KWin, so KWin is asked less often than other providers.
+	kwinPollInterval = 2 * time.Second
+)
+
+// KWin reads the focused window from KWin, which only exposes it to scripts on wayland.
+// kdotool loads a KWin script for each query and reports back what it found.
+type KWin struct {
+	path string
+}
+
+// NewKWin creates a provider, kdotool has to be installed.
+func NewKWin() (*KWin, error) {
+	path, err := exec.LookPath(kdotool)
+	if err != nil {
+		return nil, errorx.Decorate(err, "find %s", kdotool)
+	}
+
+	return &KWin{path: path}, nil
+}
+
+func (k *KWin) FocusedPID(ctx context.Context) (int, error) {
+	out, err := exec.CommandContext(ctx, k.path, "getactivewindow", "getwindowpid").Output()
+	if err != nil {
+		return 0, errorx.Decorate(err, "run %s", kdotool)
+	}
+
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return 0, nil
+	}
+
+	pid, err := strconv.Atoi(string(out))
+	if err != nil {
+		return 0, errorx.Decorate(err, "parse %s output %q", kdotool, out)
+	}
+
+	return pid, nil
+}
+
+func (k *KWin) Wait(ctx context.Context) error {
+	return poll(ctx, kwinPollInterval)
+}
+
+func (k *KWin) Close() error {
+	return nil
+}
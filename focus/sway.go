@@ -0,0 +1,247 @@
+package focus
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/joomcode/errorx"
+)
+
+// i3 IPC, which sway implements, see sway-ipc(7).
+const (
+	swayMagic      = "i3-ipc"
+	swayHeaderSize = len(swayMagic) + 8
+	swaySubscribe  = 2
+	swayGetTree    = 4
+	// events have the highest bit of their type set.
+	swayEventFlag = 1 << 31
+)
+
+// events changing the focused window, focus changes of windows and workspaces,
+// and closing a window, after which an empty workspace may be focused without a focus event.
+//
+//nolint:gochecknoglobals // constant list.
+var swayFocusChanges = []string{"focus", "close"}
+
+// Sway reads the focused window from the tree of a sway session, asking over its IPC socket
+// whenever a window or workspace event reports a focus change.
+type Sway struct {
+	socket string
+
+	// connection subscribed to window and workspace events, nil until Wait subscribes.
+	events net.Conn
+}
+
+// swayNode is a node of the sway tree with the fields needed to find the focused window.
+type swayNode struct {
+	Focused       bool       `json:"focused"`
+	PID           int        `json:"pid"`
+	Nodes         []swayNode `json:"nodes"`
+	FloatingNodes []swayNode `json:"floating_nodes"`
+}
+
+// NewSway creates a provider for the IPC socket, which sway exports as SWAYSOCK.
+func NewSway(socket string) (*Sway, error) {
+	if socket == "" {
+		return nil, errorx.IllegalArgument.New("SWAYSOCK is not set")
+	}
+
+	return &Sway{socket: socket, events: nil}, nil
+}
+
+func (s *Sway) FocusedPID(ctx context.Context) (int, error) {
+	payload, err := s.request(ctx, swayGetTree)
+	if err != nil {
+		return 0, err
+	}
+
+	var root swayNode
+
+	err = json.Unmarshal(payload, &root)
+	if err != nil {
+		return 0, errorx.Decorate(err, "decode tree")
+	}
+
+	focused := findFocused(root)
+	if focused == nil {
+		return 0, nil
+	}
+
+	return focused.PID, nil
+}
+
+func (s *Sway) Wait(ctx context.Context) error {
+	if s.events == nil {
+		return s.subscribe(ctx)
+	}
+
+	conn := s.events
+
+	stop := context.AfterFunc(ctx, func() {
+		// unblocks the read below, which fails if this does not.
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	for {
+		typ, payload, err := readSwayMessage(conn)
+		if err != nil {
+			return errorx.Decorate(errors.Join(err, s.close()), "read event")
+		}
+
+		if typ&swayEventFlag == 0 {
+			continue
+		}
+
+		var event struct {
+			Change string `json:"change"`
+		}
+
+		err = json.Unmarshal(payload, &event)
+		if err != nil {
+			return errorx.Decorate(errors.Join(err, s.close()), "decode event")
+		}
+
+		if slices.Contains(swayFocusChanges, event.Change) {
+			return nil
+		}
+	}
+}
+
+func (s *Sway) Close() error {
+	return s.close()
+}
+
+func (s *Sway) close() error {
+	if s.events == nil {
+		return nil
+	}
+
+	err := s.events.Close()
+	s.events = nil
+
+	if err != nil {
+		return errorx.Decorate(err, "close event connection")
+	}
+
+	return nil
+}
+
+// subscribe connects to window and workspace events.
+func (s *Sway) subscribe(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", s.socket)
+	if err != nil {
+		return errorx.Decorate(err, "connect to %s", s.socket)
+	}
+
+	err = writeSwayMessage(conn, swaySubscribe, []byte(`["window","workspace"]`))
+	if err != nil {
+		return errorx.Decorate(errors.Join(err, conn.Close()), "subscribe")
+	}
+
+	_, payload, err := readSwayMessage(conn)
+	if err != nil {
+		return errorx.Decorate(errors.Join(err, conn.Close()), "subscribe")
+	}
+
+	var reply struct {
+		Success bool `json:"success"`
+	}
+
+	err = json.Unmarshal(payload, &reply)
+	if err != nil {
+		return errorx.Decorate(errors.Join(err, conn.Close()), "decode subscribe reply")
+	}
+
+	if !reply.Success {
+		return errors.Join(errorx.IllegalState.New("subscribe refused"), conn.Close())
+	}
+
+	s.events = conn
+
+	return nil
+}
+
+func (s *Sway) request(ctx context.Context, typ uint32) (payload []byte, err error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", s.socket)
+	if err != nil {
+		return nil, errorx.Decorate(err, "connect to %s", s.socket)
+	}
+	defer closeConn(conn, &err)
+
+	err = writeSwayMessage(conn, typ, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, payload, err = readSwayMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func writeSwayMessage(conn net.Conn, typ uint32, payload []byte) error {
+	// messages use the byte order of the host.
+	req := []byte(swayMagic)
+	req = binary.NativeEndian.AppendUint32(req, uint32(len(payload)))
+	req = binary.NativeEndian.AppendUint32(req, typ)
+	req = append(req, payload...)
+
+	_, err := conn.Write(req)
+	if err != nil {
+		return errorx.Decorate(err, "write message")
+	}
+
+	return nil
+}
+
+func readSwayMessage(conn net.Conn) (uint32, []byte, error) {
+	header := make([]byte, swayHeaderSize)
+
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return 0, nil, errorx.Decorate(err, "read message header")
+	}
+
+	if string(header[:len(swayMagic)]) != swayMagic {
+		return 0, nil, errorx.IllegalFormat.New("invalid message magic %q", header[:len(swayMagic)])
+	}
+
+	payload := make([]byte, binary.NativeEndian.Uint32(header[len(swayMagic):]))
+
+	_, err = io.ReadFull(conn, payload)
+	if err != nil {
+		return 0, nil, errorx.Decorate(err, "read message")
+	}
+
+	return binary.NativeEndian.Uint32(header[len(swayMagic)+4:]), payload, nil
+}
+
+// findFocused returns the focused node below node, which is a window for sway, or nil if none is focused.
+func findFocused(node swayNode) *swayNode {
+	if node.Focused {
+		return &node
+	}
+
+	for _, children := range [][]swayNode{node.Nodes, node.FloatingNodes} {
+		for _, child := range children {
+			if focused := findFocused(child); focused != nil {
+				return focused
+			}
+		}
+	}
+
+	return nil
+}
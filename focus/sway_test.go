@@ -0,0 +1,194 @@
+package focus
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	swayWorkspaceEvent = swayEventFlag | 0
+	swayWindowEvent    = swayEventFlag | 3
+
+	testTimeout = 2 * time.Second
+)
+
+func TestFindFocused(t *testing.T) {
+	tests := []struct {
+		name string
+		root swayNode
+		pid  int
+		ok   bool
+	}{
+		{
+			name: "none",
+			root: swayNode{Nodes: []swayNode{{PID: 1}, {PID: 2}}},
+		},
+		{
+			name: "nested",
+			root: swayNode{Nodes: []swayNode{
+				{PID: 1},
+				{Nodes: []swayNode{{PID: 2}, {Focused: true, PID: 3}}},
+			}},
+			pid: 3,
+			ok:  true,
+		},
+		{
+			name: "floating",
+			root: swayNode{Nodes: []swayNode{
+				{Nodes: []swayNode{{PID: 1}}, FloatingNodes: []swayNode{{Focused: true, PID: 2}}},
+			}},
+			pid: 2,
+			ok:  true,
+		},
+		{
+			// an empty workspace is focused, which has no pid.
+			name: "workspace",
+			root: swayNode{Nodes: []swayNode{{Focused: true}}},
+			pid:  0,
+			ok:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			focused := findFocused(test.root)
+
+			if (focused != nil) != test.ok || (focused != nil && focused.PID != test.pid) {
+				t.Fatalf("expected pid %d (%v), got %+v", test.pid, test.ok, focused)
+			}
+		})
+	}
+}
+
+func TestSway(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "sway.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	subscribed := make(chan net.Conn, 1)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSway(t, conn, subscribed)
+		}
+	}()
+
+	s, err := NewSway(socket)
+	if err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+
+	t.Cleanup(func() {
+		err := s.Close()
+		if err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+
+	ctx := context.Background()
+
+	pid, err := s.FocusedPID(ctx)
+	if err != nil || pid != 42 {
+		t.Fatalf("expected pid 42, got %d (%v)", pid, err)
+	}
+
+	// the first wait subscribes and returns right away.
+	err = s.Wait(ctx)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	var events net.Conn
+
+	select {
+	case events = <-subscribed:
+	case <-time.After(testTimeout):
+		t.Fatal("provider did not subscribe")
+	}
+
+	waited := make(chan error, 1)
+
+	go func() {
+		waited <- s.Wait(ctx)
+	}()
+
+	sendSway(t, events, swayWindowEvent, `{"change":"title"}`)
+
+	select {
+	case err := <-waited:
+		t.Fatalf("expected title changes to be ignored, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sendSway(t, events, swayWorkspaceEvent, `{"change":"focus"}`)
+
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("focus event did not end the wait")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		waited <- s.Wait(ctx)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Fatal("expected an error after cancelling")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("cancelling did not end the wait")
+	}
+}
+
+// serveSway answers a GET_TREE request with a tree focusing pid 42, or a SUBSCRIBE request by passing on conn.
+func serveSway(t *testing.T, conn net.Conn, subscribed chan<- net.Conn) {
+	typ, _, err := readSwayMessage(conn)
+	if err != nil {
+		t.Errorf("read request: %v", err)
+
+		return
+	}
+
+	switch typ {
+	case swayGetTree:
+		sendSway(t, conn, swayGetTree, `{"nodes":[{"nodes":[{"pid":41},{"focused":true,"pid":42}]}]}`)
+		conn.Close()
+	case swaySubscribe:
+		sendSway(t, conn, swaySubscribe, `{"success":true}`)
+		subscribed <- conn
+	default:
+		t.Errorf("unexpected request %d", typ)
+		conn.Close()
+	}
+}
+
+func sendSway(t *testing.T, conn net.Conn, typ uint32, payload string) {
+	err := writeSwayMessage(conn, typ, []byte(payload))
+	if err != nil {
+		t.Errorf("write message: %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package focus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joomcode/errorx"
+)
+
+// X11 requests and replies, see the X Window System Protocol specification.
+const (
+	x11ByteOrderLSB  = 'l'
+	x11MajorVersion  = 11
+	x11SetupHeader   = 8
+	x11ReplySize     = 32
+	x11ReplyError    = 0
+	x11ReplyOK       = 1
+	x11SetupSuccess  = 1
+	x11OpInternAtom  = 16
+	x11OpGetProperty = 20
+	x11AnyType       = 0
+
+	// offsets into the setup reply data.
+	x11SetupVendorLen  = 16
+	x11SetupNumFormats = 21
+	x11SetupVendor     = 32
+	x11FormatSize      = 8
+
+	// offsets into the GetProperty reply.
+	x11PropertyFormat = 1
+	x11PropertyValues = 16
+
+	x11UnixSocketDir = "/tmp/.X11-unix"
+	x11TCPPortBase   = 6000
+	x11AuthCookie    = "MIT-MAGIC-COOKIE-1"
+	x11FamilyLocal   = 256
+	x11FamilyWild    = 65535
+
+	x11Timeout = 2 * time.Second
+)
+
+//nolint:gochecknoglobals // the client always speaks little endian, the server converts.
+var x11Order = binary.LittleEndian
+
+// X11 reads the focused window from the _NET_ACTIVE_WINDOW property of the root window,
+// which EWMH compliant window managers maintain, and its process from _NET_WM_PID.
+type X11 struct {
+	sync.Mutex `exhaustruct:"optional"`
+
+	display string
+
+	conn net.Conn
+	seq  uint16
+	root uint32
+
+	activeWindow uint32
+	wmPID        uint32
+}
+
+// NewX11 creates a provider for display, i.e. ":0". It connects lazily, so that it survives X server restarts.
+func NewX11(display string) (*X11, error) {
+	if display == "" {
+		return nil, errorx.IllegalArgument.New("DISPLAY is not set")
+	}
+
+	return &X11{
+		display: display,
+
+		conn: nil,
+		seq:  0,
+		root: 0,
+
+		activeWindow: 0,
+		wmPID:        0,
+	}, nil
+}
+
+func (x *X11) FocusedPID(_ context.Context) (int, error) {
+	x.Lock()
+	defer x.Unlock()
+
+	if x.conn == nil {
+		err := x.connect()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	pid, err := x.focusedPID()
+	if err != nil {
+		// start over with a new connection next time.
+		return 0, errors.Join(err, x.close())
+	}
+
+	return pid, nil
+}
+
+func (x *X11) Wait(ctx context.Context) error {
+	return poll(ctx, pollInterval)
+}
+
+func (x *X11) Close() error {
+	x.Lock()
+	defer x.Unlock()
+
+	return x.close()
+}
+
+func (x *X11) close() error {
+	if x.conn == nil {
+		return nil
+	}
+
+	err := x.conn.Close()
+	x.conn = nil
+
+	if err != nil {
+		return errorx.Decorate(err, "close connection")
+	}
+
+	return nil
+}
+
+func (x *X11) focusedPID() (int, error) {
+	window, err := x.property32(x.root, x.activeWindow)
+	if err != nil {
+		return 0, errorx.Decorate(err, "get _NET_ACTIVE_WINDOW")
+	}
+
+	if window == 0 {
+		return 0, nil
+	}
+
+	pid, err := x.property32(window, x.wmPID)
+	if err != nil {
+		return 0, errorx.Decorate(err, "get _NET_WM_PID")
+	}
+
+	return int(pid), nil
+}
+
+func (x *X11) connect() error {
+	host, number, err := parseDisplay(x.display)
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+
+	if host == "" || host == "unix" {
+		conn, err = net.DialTimeout("unix", filepath.Join(x11UnixSocketDir, "X"+number), x11Timeout)
+	} else {
+		port, _ := strconv.Atoi(number)
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(x11TCPPortBase+port)), x11Timeout)
+	}
+
+	if err != nil {
+		return errorx.Decorate(err, "connect to display %s", x.display)
+	}
+
+	x.conn = conn
+	x.seq = 0
+
+	err = x.setup(host, number)
+	if err != nil {
+		return errorx.Decorate(errors.Join(err, x.close()), "set up connection")
+	}
+
+	x.activeWindow, err = x.internAtom("_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return errorx.Decorate(errors.Join(err, x.close()), "intern _NET_ACTIVE_WINDOW")
+	}
+
+	x.wmPID, err = x.internAtom("_NET_WM_PID")
+	if err != nil {
+		return errorx.Decorate(errors.Join(err, x.close()), "intern _NET_WM_PID")
+	}
+
+	return nil
+}
+
+// parseDisplay splits a display name like "host:0.0" into host and display number.
+func parseDisplay(display string) (string, string, error) {
+	idx := strings.LastIndex(display, ":")
+	if idx < 0 {
+		return "", "", errorx.IllegalArgument.New("invalid display %q", display)
+	}
+
+	host := display[:idx]
+	number, _, _ := strings.Cut(display[idx+1:], ".")
+
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", "", errorx.IllegalArgument.New("invalid display %q", display)
+	}
+
+	return host, number, nil
+}
+
+func (x *X11) setup(host, number string) error {
+	authName, authData := xauthCookie(host, number)
+
+	req := []byte{x11ByteOrderLSB, 0}
+	req = x11Order.AppendUint16(req, x11MajorVersion)
+	req = x11Order.AppendUint16(req, 0)
+	req = x11Order.AppendUint16(req, uint16(len(authName)))
+	req = x11Order.AppendUint16(req, uint16(len(authData)))
+	req = append(req, 0, 0)
+	req = appendPadded(req, []byte(authName))
+	req = appendPadded(req, authData)
+
+	err := x.write(req)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, x11SetupHeader)
+
+	err = x.read(header)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, int(x11Order.Uint16(header[6:]))*4)
+
+	err = x.read(data)
+	if err != nil {
+		return err
+	}
+
+	if header[0] != x11SetupSuccess {
+		// failure replies carry the reason, authentication requests a message padded with zeros.
+		return errorx.IllegalState.New("server refused connection: %s", bytes.TrimRight(data, "\x00"))
+	}
+
+	vendorLen := int(x11Order.Uint16(data[x11SetupVendorLen:]))
+	screens := x11SetupVendor + pad4(vendorLen) + int(data[x11SetupNumFormats])*x11FormatSize
+
+	if len(data) < screens+4 {
+		return errorx.IllegalFormat.New("setup reply has no screens")
+	}
+
+	// the root window of the first screen, EWMH properties live there.
+	x.root = x11Order.Uint32(data[screens:])
+
+	return nil
+}
+
+func (x *X11) internAtom(name string) (uint32, error) {
+	req := []byte{x11OpInternAtom, 0}
+	req = x11Order.AppendUint16(req, uint16(2+pad4(len(name))/4)) //nolint:mnd // header words.
+	req = x11Order.AppendUint16(req, uint16(len(name)))
+	req = append(req, 0, 0)
+	req = appendPadded(req, []byte(name))
+
+	reply, err := x.request(req)
+	if err != nil {
+		return 0, err
+	}
+
+	return x11Order.Uint32(reply[8:]), nil
+}
+
+// property32 returns the first 32 bit value of a window property, 0 if it is not set.
+func (x *X11) property32(window, property uint32) (uint32, error) {
+	req := []byte{x11OpGetProperty, 0}
+	req = x11Order.AppendUint16(req, 6) //nolint:mnd // request words.
+	req = x11Order.AppendUint32(req, window)
+	req = x11Order.AppendUint32(req, property)
+	req = x11Order.AppendUint32(req, x11AnyType)
+	req = x11Order.AppendUint32(req, 0)
+	req = x11Order.AppendUint32(req, 1)
+
+	reply, err := x.request(req)
+	if err != nil {
+		return 0, err
+	}
+
+	//nolint:mnd // 32 bit format.
+	if reply[x11PropertyFormat] != 32 || x11Order.Uint32(reply[x11PropertyValues:]) == 0 {
+		return 0, nil
+	}
+
+	return x11Order.Uint32(reply[x11ReplySize:]), nil
+}
+
+// request sends req and returns its whole reply.
+func (x *X11) request(req []byte) ([]byte, error) {
+	err := x.write(req)
+	if err != nil {
+		return nil, err
+	}
+
+	x.seq++
+
+	reply := make([]byte, x11ReplySize)
+
+	for {
+		err = x.read(reply)
+		if err != nil {
+			return nil, err
+		}
+
+		switch reply[0] {
+		case x11ReplyError:
+			return nil, errorx.IllegalState.New("x11 error %d for request %d", reply[1], req[0])
+		case x11ReplyOK:
+		default:
+			// events are not selected, but skip them anyway.
+			continue
+		}
+
+		extra := make([]byte, int(x11Order.Uint32(reply[4:]))*4)
+
+		err = x.read(extra)
+		if err != nil {
+			return nil, err
+		}
+
+		if x11Order.Uint16(reply[2:]) != x.seq {
+			continue
+		}
+
+		return append(reply, extra...), nil
+	}
+}
+
+func (x *X11) write(b []byte) error {
+	err := x.conn.SetDeadline(time.Now().Add(x11Timeout))
+	if err != nil {
+		return errorx.Decorate(err, "set deadline")
+	}
+
+	_, err = x.conn.Write(b)
+	if err != nil {
+		return errorx.Decorate(err, "write")
+	}
+
+	return nil
+}
+
+func (x *X11) read(b []byte) error {
+	_, err := io.ReadFull(x.conn, b)
+	if err != nil {
+		return errorx.Decorate(err, "read")
+	}
+
+	return nil
+}
+
+// xauthCookie returns the MIT-MAGIC-COOKIE-1 for the display from the Xauthority file,
+// or no authentication if there is none.
+func xauthCookie(host, number string) (string, []byte) {
+	filename := os.Getenv("XAUTHORITY")
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+
+		filename = filepath.Join(home, ".Xauthority")
+	}
+
+	// read at once, the file is small.
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", nil
+	}
+
+	if host == "" || host == "unix" {
+		host, _ = os.Hostname()
+	}
+
+	r := bytes.NewReader(b)
+
+	for {
+		var family uint16
+
+		err := binary.Read(r, binary.BigEndian, &family)
+		if err != nil {
+			return "", nil
+		}
+
+		fields := make([][]byte, 4) //nolint:mnd // address, number, name and data.
+
+		for i := range fields {
+			fields[i], err = readXauthField(r)
+			if err != nil {
+				return "", nil
+			}
+		}
+
+		address, num, name, data := string(fields[0]), string(fields[1]), string(fields[2]), fields[3]
+
+		if family != x11FamilyWild && (family != x11FamilyLocal || address != host) {
+			continue
+		}
+
+		if (num == "" || num == number) && name == x11AuthCookie {
+			return name, data
+		}
+	}
+}
+
+func readXauthField(r io.Reader) ([]byte, error) {
+	var n uint16
+
+	err := binary.Read(r, binary.BigEndian, &n)
+	if err != nil {
+		return nil, errorx.Decorate(err, "read length")
+	}
+
+	b := make([]byte, n)
+
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, errorx.Decorate(err, "read field")
+	}
+
+	return b, nil
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3 //nolint:mnd // 4 byte alignment.
+}
+
+func appendPadded(b, data []byte) []byte {
+	b = append(b, data...)
+
+	return append(b, make([]byte, pad4(len(data))-len(data))...)
+}
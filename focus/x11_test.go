@@ -0,0 +1,217 @@
+package focus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// predefined atoms, see the X Window System Protocol specification.
+const (
+	x11AtomCardinal = 6
+	x11AtomWindow   = 33
+
+	x11OpChangeProperty = 18
+)
+
+func TestParseDisplay(t *testing.T) {
+	tests := []struct {
+		display, host, number string
+		ok                    bool
+	}{
+		{display: ":0", host: "", number: "0", ok: true},
+		{display: ":1.0", host: "", number: "1", ok: true},
+		{display: "unix:2", host: "unix", number: "2", ok: true},
+		{display: "remote:10.1", host: "remote", number: "10", ok: true},
+		{display: "", host: "", number: "", ok: false},
+		{display: "0", host: "", number: "", ok: false},
+		{display: ":x", host: "", number: "", ok: false},
+		{display: "remote:", host: "", number: "", ok: false},
+	}
+
+	for _, test := range tests {
+		host, number, err := parseDisplay(test.display)
+
+		if (err == nil) != test.ok || host != test.host || number != test.number {
+			t.Errorf("parseDisplay(%q) = %q, %q, %v", test.display, host, number, err)
+		}
+	}
+}
+
+func TestXauthCookie(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("hostname: %v", err)
+	}
+
+	var b []byte
+
+	for _, entry := range []struct {
+		family                      uint16
+		address, number, name, data string
+	}{
+		{family: x11FamilyLocal, address: "other", number: "0", name: x11AuthCookie, data: "other"},
+		{family: x11FamilyLocal, address: hostname, number: "0", name: "XDM-AUTHORIZATION-1", data: "xdm"},
+		{family: x11FamilyLocal, address: hostname, number: "0", name: x11AuthCookie, data: "local0"},
+		{family: x11FamilyLocal, address: hostname, number: "1", name: x11AuthCookie, data: "local1"},
+		{family: x11FamilyLocal, address: "remote", number: "0", name: x11AuthCookie, data: "remote"},
+		{family: x11FamilyWild, address: "", number: "", name: x11AuthCookie, data: "wild"},
+	} {
+		b = binary.BigEndian.AppendUint16(b, entry.family)
+
+		for _, field := range []string{entry.address, entry.number, entry.name, entry.data} {
+			b = binary.BigEndian.AppendUint16(b, uint16(len(field)))
+			b = append(b, field...)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "Xauthority")
+
+	err = os.WriteFile(filename, b, 0o600)
+	if err != nil {
+		t.Fatalf("write Xauthority: %v", err)
+	}
+
+	t.Setenv("XAUTHORITY", filename)
+
+	tests := []struct {
+		host, number, data string
+	}{
+		{host: "", number: "0", data: "local0"},
+		{host: "unix", number: "1", data: "local1"},
+		{host: "remote", number: "0", data: "remote"},
+		{host: "", number: "2", data: "wild"},
+	}
+
+	for _, test := range tests {
+		name, data := xauthCookie(test.host, test.number)
+
+		if name != x11AuthCookie || string(data) != test.data {
+			t.Errorf("xauthCookie(%q, %q) = %q, %q, expected %q", test.host, test.number, name, data, test.data)
+		}
+	}
+
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "missing"))
+
+	if name, data := xauthCookie("", "0"); name != "" || data != nil {
+		t.Errorf("expected no authentication without a file, got %q, %q", name, data)
+	}
+}
+
+// TestX11 reads the focused window from a virtual X server, setting the properties a window manager would.
+func TestX11(t *testing.T) {
+	xvfb, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb is not installed")
+	}
+
+	// Xvfb accepts local clients without authentication.
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "missing"))
+
+	x, err := NewX11(":" + startXvfb(t, xvfb))
+	if err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+
+	t.Cleanup(func() {
+		err := x.Close()
+		if err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+
+	ctx := context.Background()
+
+	pid, err := x.FocusedPID(ctx)
+	if err != nil || pid != 0 {
+		t.Fatalf("expected no focused window without a window manager, got %d (%v)", pid, err)
+	}
+
+	// announce the root window as focused, owned by a made up process.
+	x.Lock()
+	changeProperty32(t, x, x.root, x.activeWindow, x11AtomWindow, x.root)
+	changeProperty32(t, x, x.root, x.wmPID, x11AtomCardinal, 4242)
+	x.Unlock()
+
+	pid, err = x.FocusedPID(ctx)
+	if err != nil || pid != 4242 {
+		t.Fatalf("expected pid 4242, got %d (%v)", pid, err)
+	}
+}
+
+// startXvfb starts Xvfb on a free display and returns its number.
+func startXvfb(t *testing.T, xvfb string) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+
+	defer r.Close()
+
+	// Xvfb writes the display it picked to fd 3 once it accepts connections.
+	cmd := exec.Command(xvfb, "-displayfd", "3", "-nolisten", "tcp")
+	cmd.ExtraFiles = []*os.File{w}
+
+	err = cmd.Start()
+
+	w.Close()
+
+	if err != nil {
+		t.Fatalf("start Xvfb: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	numbers := make(chan string, 1)
+
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		numbers <- strings.TrimSpace(line)
+	}()
+
+	select {
+	case number := <-numbers:
+		if number == "" {
+			t.Fatal("Xvfb exited without a display")
+		}
+
+		return number
+	case <-time.After(10 * time.Second):
+		t.Fatal("Xvfb did not start")
+	}
+
+	return ""
+}
+
+// changeProperty32 sets a 32 bit property of window, it has to be called with the lock held.
+func changeProperty32(t *testing.T, x *X11, window, property, typ, value uint32) {
+	t.Helper()
+
+	req := []byte{x11OpChangeProperty, 0}
+	req = x11Order.AppendUint16(req, 7) //nolint:mnd // request words.
+	req = x11Order.AppendUint32(req, window)
+	req = x11Order.AppendUint32(req, property)
+	req = x11Order.AppendUint32(req, typ)
+	req = append(req, 32, 0, 0, 0) //nolint:mnd // 32 bit format.
+	req = x11Order.AppendUint32(req, 1)
+	req = x11Order.AppendUint32(req, value)
+
+	err := x.write(req)
+	if err != nil {
+		t.Fatalf("change property: %v", err)
+	}
+
+	// requests without a reply are counted too.
+	x.seq++
+}
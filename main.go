@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/joomcode/errorx"
 	"github.com/omriharel/deej/config"
+	"github.com/omriharel/deej/focus"
 	"github.com/omriharel/deej/serial"
 	"github.com/omriharel/deej/session"
 	"github.com/omriharel/deej/sliders"
@@ -37,19 +41,117 @@ func main() {
 
 	ctx = logger.WithContext(ctx)
 
-	exitCode := tray.InitializeTray(ctx, cancel, start)
+	configFlag := flag.String("config", "", "path to the config file")
+
+	flag.Parse()
+
+	filename, err := config.Find(*configFlag)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to find config")
+
+		os.Exit(1)
+	}
+
+	// load the config before the tray, so that problems with it are printed right away.
+	cfg, err := config.Load(ctx, filename)
+	if err != nil {
+		config.LogError(ctx, filename, "Failed to load config", err)
+
+		os.Exit(1)
+	}
+
+	logger.Info().Str("filename", filename).Msg("Config loaded")
+
+	exitCode := tray.InitializeTray(ctx, cancel, func(ctx context.Context, cancel context.CancelFunc, t *tray.Tray) error {
+		return start(ctx, cancel, t, filename, cfg)
+	})
 
 	os.Exit(exitCode)
 }
 
-func start(ctx context.Context, cancel context.CancelFunc) error {
+// serialConn is a serial connection that can be stopped independently of deej.
+type serialConn struct {
+	*serial.Serial
+
+	cancel context.CancelFunc
+}
+
+// startSerial connects to the board and makes it the current connection,
+// which has to happen before it connects, so that volumes are resent through it.
+func startSerial(
+	ctx context.Context, cfg *config.Config, t *tray.Tray, slds *sliders.Sliders, current *atomic.Pointer[serialConn],
+) *serialConn {
+	ctx, cancel := context.WithCancel(ctx)
+
+	sp := serial.NewSerial(cfg.SerialPort, cfg.BaudRate, serial.Match{
+		VID:    cfg.USBVID,
+		PID:    cfg.USBPID,
+		Serial: cfg.USBSerial,
+		ByID:   cfg.SerialByID,
+	})
+
+	sp.OnState(func(_ context.Context, state serial.State) {
+		switch state {
+		case serial.StateConnected:
+			t.SetStatus("Connected")
+
+			err := sp.Write(serial.FormatHandshake())
+			if err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to send handshake")
+			}
+
+			slds.ResendVolumes(ctx)
+		case serial.StateDisconnected:
+			t.SetStatus("Disconnected, waiting for the board")
+
+			// the next board might not send a handshake.
+			slds.SetHandshake(ctx, nil)
+		}
+	})
+
+	conn := &serialConn{Serial: sp, cancel: cancel}
+
+	current.Store(conn)
+
+	sp.Run(ctx)
+
+	return conn
+}
+
+// startFocus follows the focused window for deej.current targets until the returned function is called.
+func startFocus(ctx context.Context, cfg *config.Config, slds *sliders.Sliders) context.CancelFunc {
+	logger := zerolog.Ctx(ctx)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	provider, err := focus.New(cfg.FocusProvider)
+
+	switch {
+	case err != nil:
+		logger.Error().Err(err).Msg("Failed to create focus provider, deej.current will not select anything")
+	case provider == nil:
+		logger.Debug().Msg("No focus provider, deej.current will not select anything")
+	default:
+		pids := focus.Watch(ctx, provider)
+
+		go func() {
+			for pid := range pids {
+				slds.SetFocused(ctx, pid)
+			}
+		}()
+	}
+
+	return cancel
+}
+
+func start(ctx context.Context, cancel context.CancelFunc, t *tray.Tray, filename string, cfg *config.Config) error {
 	defer cancel()
 
 	logger := zerolog.Ctx(ctx)
 
-	config, err := config.Load(ctx, "config.yaml")
+	configs, err := config.Watch(ctx, filename)
 	if err != nil {
-		return errorx.Decorate(err, "load config")
+		return errorx.Decorate(err, "watch config")
 	}
 
 	sm, err := session.NewMonitor(ctx)
@@ -57,27 +159,107 @@ func start(ctx context.Context, cancel context.CancelFunc) error {
 		return errorx.Decorate(err, "create session monitor")
 	}
 
-	slds := sliders.NewSliders(ctx, config.SliderMapping, sm)
+	slds := sliders.NewSliders(ctx, cfg, sm)
 
-	sp := serial.NewSerial(config.SerialPort, config.BaudRate)
+	// volumes are reported from the session monitor, while the connection may be swapped on config changes.
+	var current atomic.Pointer[serialConn]
 
-	err = sp.Run(ctx)
-	if err != nil {
-		return errorx.Decorate(err, "run serial connection")
-	}
+	slds.OnVolume(func(_ context.Context, idx, value int, muted bool) {
+		conn := current.Load()
+		if conn == nil {
+			return
+		}
+
+		err := conn.Write(serial.FormatVolume(idx, value, muted))
+		if err != nil && !errors.Is(err, serial.ErrNotConnected) {
+			logger.Error().Err(err).Int("idx", idx).Msg("Failed to report volume")
+		}
+	})
+
+	sp := startSerial(ctx, cfg, t, slds, &current)
+	stopFocus := startFocus(ctx, cfg, slds)
 
 	for {
 		select {
 		case line := <-sp.Lines:
 			logger.Trace().Bytes("line", line).Str("line", string(line)).Msg("Received serial line")
 
-			slds.HandleLine(ctx, line)
-		case err := <-sp.Errors:
-			logger.Error().Err(err).Msg("Serial error")
+			handleLine(ctx, slds, line)
+		case newCfg := <-configs:
+			slds.FromConfig(ctx, newCfg)
+
+			if serialChanged(cfg, newCfg) {
+				sp.cancel()
 
-			return err
+				sp = startSerial(ctx, newCfg, t, slds, &current)
+
+				logger.Info().Str("port", newCfg.SerialPort).Int("baud_rate", newCfg.BaudRate).Msg("Serial connection restarted")
+			}
+
+			if newCfg.FocusProvider != cfg.FocusProvider {
+				stopFocus()
+
+				slds.SetFocused(ctx, 0)
+
+				stopFocus = startFocus(ctx, newCfg, slds)
+			}
+
+			cfg = newCfg
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
+
+func handleLine(ctx context.Context, slds *sliders.Sliders, line []byte) {
+	logger := zerolog.Ctx(ctx)
+
+	switch typ := serial.MessageType(line); typ {
+	case "":
+		slds.HandleLine(ctx, line)
+	case serial.MessageHandshake:
+		handshake, err := serial.ParseHandshake(line)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to parse handshake")
+
+			return
+		}
+
+		slds.SetHandshake(ctx, &handshake)
+	case serial.MessageButton:
+		idx, pressed, err := serial.ParseButton(line)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to parse button event")
+
+			return
+		}
+
+		slds.HandleButton(ctx, idx, pressed)
+	case serial.MessageEncoder:
+		idx, steps, err := serial.ParseEncoder(line)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to parse encoder event")
+
+			return
+		}
+
+		slds.HandleEncoder(ctx, idx, steps)
+	case serial.MessagePush:
+		idx, pressed, err := serial.ParsePush(line)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to parse encoder push event")
+
+			return
+		}
+
+		slds.HandlePush(ctx, idx, pressed)
+	default:
+		logger.Debug().Str("type", typ).Msg("Ignoring unknown message")
+	}
+}
+
+func serialChanged(old, cfg *config.Config) bool {
+	return old.SerialPort != cfg.SerialPort || old.BaudRate != cfg.BaudRate ||
+		old.USBVID != cfg.USBVID || old.USBPID != cfg.USBPID ||
+		old.USBSerial != cfg.USBSerial || old.SerialByID != cfg.SerialByID
+}
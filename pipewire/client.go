@@ -0,0 +1,504 @@
+package pipewire
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/rs/zerolog"
+)
+
+// native protocol object ids and versions, see pipewire/core.h.
+const (
+	coreID     = 0
+	clientID   = 1
+	registryID = 2
+	firstID    = 3
+
+	coreVersion     = 3
+	registryVersion = 3
+	nodeVersion     = 3
+
+	messageHeaderSize = 16
+	opcodeShift       = 24
+	sizeMask          = 0xffffff
+)
+
+// native protocol opcodes, see pipewire/extensions/protocol-native.h.
+const (
+	coreMethodHello       = 1
+	coreMethodPong        = 3
+	coreMethodGetRegistry = 5
+
+	coreEventPing     = 2
+	coreEventError    = 3
+	coreEventRemoveID = 4
+
+	clientMethodUpdateProperties = 2
+
+	registryMethodBind = 1
+
+	registryEventGlobalRemove = 1
+
+	nodeMethodSetParam = 3
+
+	nodeEventInfo = 0
+)
+
+// SPA ids used to build the Props param, see spa/param/props.h.
+const (
+	spaParamProps         = 2
+	spaTypeObjectProps    = 0x40002
+	spaPropVolume         = 0x10003
+	spaPropMute           = 0x10004
+	spaPropChannelVolumes = 0x10008
+)
+
+const (
+	defaultRemote = "pipewire-0"
+
+	requestTimeout = 2 * time.Second
+)
+
+type nodeProxy struct {
+	id       uint32
+	globalID int
+
+	ready chan struct{}
+}
+
+// Client talks to the pipewire daemon over the native protocol socket.
+// It connects lazily and reconnects on the next call after the connection is lost.
+type Client struct {
+	sync.Mutex `exhaustruct:"optional"`
+
+	conn net.Conn
+	gone chan struct{}
+	seq  uint32
+
+	nextID  uint32
+	freeIDs []uint32
+
+	nodes   map[int]*nodeProxy
+	proxies map[uint32]*nodeProxy
+}
+
+func NewClient() *Client {
+	return &Client{
+		conn: nil,
+		gone: nil,
+		seq:  0,
+
+		nextID:  firstID,
+		freeIDs: nil,
+
+		nodes:   nil,
+		proxies: nil,
+	}
+}
+
+func socketPath() string {
+	remote := os.Getenv("PIPEWIRE_REMOTE")
+	if remote == "" {
+		remote = defaultRemote
+	}
+
+	if filepath.IsAbs(remote) {
+		return remote
+	}
+
+	dir := os.Getenv("PIPEWIRE_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.Getenv("XDG_RUNTIME_DIR")
+	}
+
+	return filepath.Join(dir, remote)
+}
+
+// connect has to be called with the lock held.
+func (c *Client) connect(ctx context.Context) error {
+	if c.conn != nil {
+		return nil
+	}
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "unix", socketPath())
+	if err != nil {
+		return errorx.Decorate(err, "dial pipewire socket")
+	}
+
+	c.conn = conn
+	c.gone = make(chan struct{})
+	c.seq = 0
+	c.nextID = firstID
+	c.freeIDs = nil
+	c.nodes = make(map[int]*nodeProxy)
+	c.proxies = make(map[uint32]*nodeProxy)
+
+	err = c.hello()
+	if err != nil {
+		c.conn = nil
+
+		return errorx.Decorate(errors.Join(err, conn.Close()), "handshake")
+	}
+
+	go c.read(ctx, conn)
+
+	return nil
+}
+
+// hello has to be called with the lock held.
+func (c *Client) hello() error {
+	err := c.send(coreID, coreMethodHello, func(b *podBuilder) {
+		b.Int(coreVersion)
+	})
+	if err != nil {
+		return errorx.Decorate(err, "send hello")
+	}
+
+	err = c.send(clientID, clientMethodUpdateProperties, func(b *podBuilder) {
+		b.Dict(map[string]string{
+			"application.name": "deej",
+		})
+	})
+	if err != nil {
+		return errorx.Decorate(err, "send client properties")
+	}
+
+	err = c.send(coreID, coreMethodGetRegistry, func(b *podBuilder) {
+		b.Int(registryVersion)
+		b.Int(registryID)
+	})
+	if err != nil {
+		return errorx.Decorate(err, "get registry")
+	}
+
+	return nil
+}
+
+// send has to be called with the lock held.
+func (c *Client) send(id, opcode uint32, f func(b *podBuilder)) error {
+	var b podBuilder
+
+	b.Struct(func() {
+		f(&b)
+	})
+
+	msg := make([]byte, 0, messageHeaderSize+len(b.buf))
+	msg = podOrder.AppendUint32(msg, id)
+	msg = podOrder.AppendUint32(msg, opcode<<opcodeShift|uint32(len(b.buf))&sizeMask)
+	msg = podOrder.AppendUint32(msg, c.seq)
+	msg = podOrder.AppendUint32(msg, 0)
+	msg = append(msg, b.buf...)
+
+	c.seq++
+
+	_, err := c.conn.Write(msg)
+	if err != nil {
+		return errorx.Decorate(err, "write message")
+	}
+
+	return nil
+}
+
+// newID has to be called with the lock held.
+func (c *Client) newID() uint32 {
+	if n := len(c.freeIDs); n > 0 {
+		id := c.freeIDs[n-1]
+		c.freeIDs = c.freeIDs[:n-1]
+
+		return id
+	}
+
+	id := c.nextID
+	c.nextID++
+
+	return id
+}
+
+func (c *Client) bindNode(ctx context.Context, globalID int) (*nodeProxy, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	c.Lock()
+
+	err := c.connect(ctx)
+	if err != nil {
+		c.Unlock()
+
+		return nil, errorx.Decorate(err, "connect")
+	}
+
+	node, ok := c.nodes[globalID]
+	if !ok {
+		node = &nodeProxy{
+			id:       c.newID(),
+			globalID: globalID,
+
+			ready: make(chan struct{}),
+		}
+
+		err = c.send(registryID, registryMethodBind, func(b *podBuilder) {
+			b.Int(int32(globalID))
+			b.String(TypeNode)
+			b.Int(nodeVersion)
+			b.Int(int32(node.id))
+		})
+		if err != nil {
+			c.Unlock()
+
+			return nil, errorx.Decorate(err, "bind node")
+		}
+
+		c.nodes[globalID] = node
+		c.proxies[node.id] = node
+	}
+
+	gone := c.gone
+
+	c.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, errorx.Decorate(ctx.Err(), "wait for node info")
+	case <-gone:
+		return nil, errorx.IllegalState.New("connection lost")
+	case <-node.ready:
+		return node, nil
+	}
+}
+
+// SetNodeVolume sets the volume of the node with the given global id, which has channels channel volumes.
+// Like mixers do, all channel volumes are set to v and the volume property is reset to 1,
+// so that v is the volume the node plays at. Nodes without channel volumes get their volume property set to v.
+func (c *Client) SetNodeVolume(ctx context.Context, globalID int, v float32, channels int) error {
+	return c.setNodeProps(ctx, globalID, func(b *podBuilder) {
+		if channels == 0 {
+			b.Prop(spaPropVolume, 0)
+			b.Float(v)
+
+			return
+		}
+
+		volumes := make([]float32, channels)
+		for i := range volumes {
+			volumes[i] = v
+		}
+
+		b.Prop(spaPropVolume, 0)
+		b.Float(1)
+		b.Prop(spaPropChannelVolumes, 0)
+		b.FloatArray(volumes)
+	})
+}
+
+// SetNodeMute sets the mute property of the node with the given global id.
+func (c *Client) SetNodeMute(ctx context.Context, globalID int, mute bool) error {
+	return c.setNodeProps(ctx, globalID, func(b *podBuilder) {
+		b.Prop(spaPropMute, 0)
+		b.Bool(mute)
+	})
+}
+
+// setNodeProps sets properties of the Props param, which are written by props using Prop.
+func (c *Client) setNodeProps(ctx context.Context, globalID int, props func(b *podBuilder)) error {
+	node, err := c.bindNode(ctx, globalID)
+	if err != nil {
+		return errorx.Decorate(err, "bind node")
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.proxies[node.id] != node {
+		return errorx.IllegalState.New("node %d is gone", globalID)
+	}
+
+	err = c.send(node.id, nodeMethodSetParam, func(b *podBuilder) {
+		b.ID(spaParamProps)
+		b.Int(0)
+		b.Object(spaTypeObjectProps, spaParamProps, func() {
+			props(b)
+		})
+	})
+	if err != nil {
+		return errorx.Decorate(err, "set param")
+	}
+
+	return nil
+}
+
+func (c *Client) read(ctx context.Context, conn net.Conn) {
+	logger := zerolog.Ctx(ctx)
+
+	r := bufio.NewReader(conn)
+	header := make([]byte, messageHeaderSize)
+
+	for {
+		_, err := io.ReadFull(r, header)
+		if err != nil {
+			logger.Error().Err(err).Msg("read pipewire message header")
+
+			break
+		}
+
+		id := podOrder.Uint32(header)
+		opsize := podOrder.Uint32(header[4:])
+
+		payload := make([]byte, opsize&sizeMask)
+
+		_, err = io.ReadFull(r, payload)
+		if err != nil {
+			logger.Error().Err(err).Msg("read pipewire message payload")
+
+			break
+		}
+
+		err = c.handleMessage(id, opsize>>opcodeShift, payload)
+		if err != nil {
+			logger.Error().Err(err).Uint32("id", id).Uint32("opcode", opsize>>opcodeShift).Msg("handle pipewire message")
+		}
+	}
+
+	c.disconnect(logger.With().Logger(), conn)
+}
+
+func (c *Client) disconnect(logger zerolog.Logger, conn net.Conn) {
+	c.Lock()
+	defer c.Unlock()
+
+	err := conn.Close()
+	if err != nil {
+		logger.Debug().Err(err).Msg("close pipewire socket")
+	}
+
+	if c.conn != conn {
+		return
+	}
+
+	c.conn = nil
+
+	close(c.gone)
+}
+
+func (c *Client) handleMessage(id, opcode uint32, payload []byte) error {
+	pr := podReader{buf: payload}
+
+	r, err := pr.Struct()
+	if err != nil {
+		return errorx.Decorate(err, "read message struct")
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	switch id {
+	case coreID:
+		return c.handleCoreEvent(opcode, r)
+	case registryID:
+		return c.handleRegistryEvent(opcode, r)
+	}
+
+	node, ok := c.proxies[id]
+	if !ok || opcode != nodeEventInfo {
+		return nil
+	}
+
+	c.handleNodeInfo(node)
+
+	return nil
+}
+
+func (c *Client) handleCoreEvent(opcode uint32, r *podReader) error {
+	switch opcode {
+	case coreEventPing:
+		id, err := r.Int()
+		if err != nil {
+			return errorx.Decorate(err, "read ping id")
+		}
+
+		seq, err := r.Int()
+		if err != nil {
+			return errorx.Decorate(err, "read ping seq")
+		}
+
+		return c.send(coreID, coreMethodPong, func(b *podBuilder) {
+			b.Int(id)
+			b.Int(seq)
+		})
+	case coreEventError:
+		return readCoreError(r)
+	case coreEventRemoveID:
+		id, err := r.Int()
+		if err != nil {
+			return errorx.Decorate(err, "read removed id")
+		}
+
+		if node, ok := c.proxies[uint32(id)]; ok {
+			delete(c.proxies, node.id)
+
+			if c.nodes[node.globalID] == node {
+				delete(c.nodes, node.globalID)
+			}
+		}
+
+		c.freeIDs = append(c.freeIDs, uint32(id))
+	}
+
+	return nil
+}
+
+func readCoreError(r *podReader) error {
+	id, err := r.Int()
+	if err != nil {
+		return errorx.Decorate(err, "read error id")
+	}
+
+	_, err = r.Int()
+	if err != nil {
+		return errorx.Decorate(err, "read error seq")
+	}
+
+	res, err := r.Int()
+	if err != nil {
+		return errorx.Decorate(err, "read error code")
+	}
+
+	message, err := r.String()
+	if err != nil {
+		return errorx.Decorate(err, "read error message")
+	}
+
+	return errorx.ExternalError.New("pipewire error on object %d: %s (%d)", id, message, res)
+}
+
+func (c *Client) handleRegistryEvent(opcode uint32, r *podReader) error {
+	if opcode != registryEventGlobalRemove {
+		return nil
+	}
+
+	id, err := r.Int()
+	if err != nil {
+		return errorx.Decorate(err, "read removed global id")
+	}
+
+	delete(c.nodes, int(id))
+
+	return nil
+}
+
+func (c *Client) handleNodeInfo(node *nodeProxy) {
+	select {
+	case <-node.ready:
+	default:
+		close(node.ready)
+	}
+}
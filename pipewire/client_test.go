@@ -0,0 +1,447 @@
+package pipewire
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testTimeout = 2 * time.Second
+
+// fakeServer accepts connections of a Client on a unix socket and speaks the native protocol with it.
+type fakeServer struct {
+	conns chan *fakeConn
+}
+
+type fakeConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	seq  uint32
+}
+
+type fakeProp struct {
+	key  uint32
+	typ  uint32
+	body []byte
+}
+
+type fakeMessage struct {
+	id     uint32
+	opcode uint32
+	fields *podReader
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "pipewire-0")
+	t.Setenv("PIPEWIRE_REMOTE", socket)
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	s := &fakeServer{conns: make(chan *fakeConn, 1)}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			s.conns <- &fakeConn{conn: conn, r: bufio.NewReader(conn), seq: 0}
+		}
+	}()
+
+	return s
+}
+
+// accept waits for the next connection and checks the messages the client sends right after connecting.
+func (s *fakeServer) accept(t *testing.T) *fakeConn {
+	t.Helper()
+
+	var c *fakeConn
+
+	select {
+	case c = <-s.conns:
+	case <-time.After(testTimeout):
+		t.Fatal("client did not connect")
+	}
+
+	t.Cleanup(func() {
+		c.conn.Close()
+	})
+
+	hello := c.read(t)
+	expectMessage(t, hello, coreID, coreMethodHello)
+	expectInt(t, hello.fields, coreVersion)
+
+	props := c.read(t)
+	expectMessage(t, props, clientID, clientMethodUpdateProperties)
+
+	dict, err := props.fields.Struct()
+	if err != nil {
+		t.Fatalf("read client properties: %v", err)
+	}
+
+	expectInt(t, dict, 1)
+	expectString(t, dict, "application.name")
+	expectString(t, dict, "deej")
+
+	registry := c.read(t)
+	expectMessage(t, registry, coreID, coreMethodGetRegistry)
+	expectInt(t, registry.fields, registryVersion)
+	expectInt(t, registry.fields, registryID)
+
+	return c
+}
+
+func (c *fakeConn) read(t *testing.T) fakeMessage {
+	t.Helper()
+
+	err := c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+	if err != nil {
+		t.Fatalf("set deadline: %v", err)
+	}
+
+	header := make([]byte, messageHeaderSize)
+
+	_, err = io.ReadFull(c.r, header)
+	if err != nil {
+		t.Fatalf("read header: %v", err)
+	}
+
+	opsize := podOrder.Uint32(header[4:])
+	payload := make([]byte, opsize&sizeMask)
+
+	_, err = io.ReadFull(c.r, payload)
+	if err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+
+	pr := podReader{buf: payload}
+
+	fields, err := pr.Struct()
+	if err != nil {
+		t.Fatalf("read message struct: %v", err)
+	}
+
+	return fakeMessage{id: podOrder.Uint32(header), opcode: opsize >> opcodeShift, fields: fields}
+}
+
+func (c *fakeConn) send(t *testing.T, id, opcode uint32, f func(b *podBuilder)) {
+	t.Helper()
+
+	var b podBuilder
+
+	b.Struct(func() {
+		f(&b)
+	})
+
+	msg := podOrder.AppendUint32(nil, id)
+	msg = podOrder.AppendUint32(msg, opcode<<opcodeShift|uint32(len(b.buf)))
+	msg = podOrder.AppendUint32(msg, c.seq)
+	msg = podOrder.AppendUint32(msg, 0)
+	msg = append(msg, b.buf...)
+
+	c.seq++
+
+	_, err := c.conn.Write(msg)
+	if err != nil {
+		t.Fatalf("write message: %v", err)
+	}
+}
+
+// bind checks a bind of the node with globalID and sends its info, returning the proxy id chosen by the client.
+func (c *fakeConn) bind(t *testing.T, globalID int) uint32 {
+	t.Helper()
+
+	msg := c.read(t)
+	expectMessage(t, msg, registryID, registryMethodBind)
+	expectInt(t, msg.fields, int32(globalID))
+	expectString(t, msg.fields, TypeNode)
+	expectInt(t, msg.fields, nodeVersion)
+
+	id, err := msg.fields.Int()
+	if err != nil {
+		t.Fatalf("read new id: %v", err)
+	}
+
+	c.send(t, uint32(id), nodeEventInfo, func(b *podBuilder) {
+		b.Int(int32(globalID))
+	})
+
+	return uint32(id)
+}
+
+// ping sends a ping and waits for its pong, after which every message sent before was handled by the client.
+func (c *fakeConn) ping(t *testing.T, seq int32) {
+	t.Helper()
+
+	c.send(t, coreID, coreEventPing, func(b *podBuilder) {
+		b.Int(coreID)
+		b.Int(seq)
+	})
+
+	pong := c.read(t)
+	expectMessage(t, pong, coreID, coreMethodPong)
+	expectInt(t, pong.fields, coreID)
+	expectInt(t, pong.fields, seq)
+}
+
+// readProps checks a SetParam message setting Props on the proxy id and returns its properties.
+func (c *fakeConn) readProps(t *testing.T, id uint32) []fakeProp {
+	t.Helper()
+
+	msg := c.read(t)
+	expectMessage(t, msg, id, nodeMethodSetParam)
+
+	param, err := msg.fields.word(podTypeID)
+	if err != nil || param != spaParamProps {
+		t.Fatalf("expected param id %d, got %d (%v)", spaParamProps, param, err)
+	}
+
+	expectInt(t, msg.fields, 0)
+
+	typ, body, err := msg.fields.next()
+	if err != nil || typ != podTypeObject {
+		t.Fatalf("expected object pod, got %d (%v)", typ, err)
+	}
+
+	if objType, objID := podOrder.Uint32(body), podOrder.Uint32(body[4:]); objType != spaTypeObjectProps || objID != spaParamProps {
+		t.Fatalf("expected props object, got type %#x id %d", objType, objID)
+	}
+
+	props := make([]fakeProp, 0)
+	rest := body[8:]
+
+	for len(rest) > 0 {
+		key, flags := podOrder.Uint32(rest), podOrder.Uint32(rest[4:])
+		if flags != 0 {
+			t.Fatalf("expected no prop flags, got %d", flags)
+		}
+
+		value := podReader{buf: rest[8:]}
+
+		typ, body, err := value.next()
+		if err != nil {
+			t.Fatalf("read prop value: %v", err)
+		}
+
+		props = append(props, fakeProp{key: key, typ: typ, body: body})
+		rest = value.buf
+	}
+
+	return props
+}
+
+func expectFloat(t *testing.T, prop fakeProp, key uint32, expected float32) {
+	t.Helper()
+
+	if prop.key != key || prop.typ != podTypeFloat || math.Float32frombits(podOrder.Uint32(prop.body)) != expected {
+		t.Fatalf("expected prop %#x to be %g, got %+v", key, expected, prop)
+	}
+}
+
+func expectMessage(t *testing.T, msg fakeMessage, id, opcode uint32) {
+	t.Helper()
+
+	if msg.id != id || msg.opcode != opcode {
+		t.Fatalf("expected message %d/%d, got %d/%d", id, opcode, msg.id, msg.opcode)
+	}
+}
+
+func expectInt(t *testing.T, r *podReader, expected int32) {
+	t.Helper()
+
+	v, err := r.Int()
+	if err != nil || v != expected {
+		t.Fatalf("expected int %d, got %d (%v)", expected, v, err)
+	}
+}
+
+func expectString(t *testing.T, r *podReader, expected string) {
+	t.Helper()
+
+	v, err := r.String()
+	if err != nil || v != expected {
+		t.Fatalf("expected string %q, got %q (%v)", expected, v, err)
+	}
+}
+
+// async runs f in the background, since calls on the client block until the fake server answered.
+func async(f func() error) <-chan error {
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- f()
+	}()
+
+	return errs
+}
+
+func wait(t *testing.T, errs <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("call did not return")
+	}
+}
+
+// connect sets the volume of the node with globalID through a new connection, returning it and the proxy id.
+func connect(t *testing.T, s *fakeServer, c *Client, globalID int) (*fakeConn, uint32) {
+	t.Helper()
+
+	errs := async(func() error {
+		return c.SetNodeVolume(context.Background(), globalID, 0.5, 0)
+	})
+
+	conn := s.accept(t)
+	id := conn.bind(t, globalID)
+
+	props := conn.readProps(t, id)
+	if len(props) != 1 {
+		t.Fatalf("expected only the volume prop, got %+v", props)
+	}
+
+	expectFloat(t, props[0], spaPropVolume, 0.5)
+
+	wait(t, errs)
+
+	return conn, id
+}
+
+func TestSetNodeVolumeAndMute(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+
+	conn, id := connect(t, s, c, 42)
+
+	if id != firstID {
+		t.Fatalf("expected first proxy id %d, got %d", firstID, id)
+	}
+
+	// the node is bound already.
+	errs := async(func() error {
+		return c.SetNodeMute(context.Background(), 42, true)
+	})
+
+	props := conn.readProps(t, id)
+	if len(props) != 1 || props[0].key != spaPropMute || props[0].typ != podTypeBool || podOrder.Uint32(props[0].body) != 1 {
+		t.Fatalf("expected mute, got %+v", props)
+	}
+
+	wait(t, errs)
+}
+
+func TestSetNodeChannelVolumes(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+
+	conn, id := connect(t, s, c, 42)
+
+	errs := async(func() error {
+		return c.SetNodeVolume(context.Background(), 42, 0.25, 2)
+	})
+
+	props := conn.readProps(t, id)
+	if len(props) != 2 {
+		t.Fatalf("expected volume and channel volumes, got %+v", props)
+	}
+
+	expectFloat(t, props[0], spaPropVolume, 1)
+
+	channels := props[1]
+	if channels.key != spaPropChannelVolumes || channels.typ != podTypeArray {
+		t.Fatalf("expected channel volumes array, got %+v", channels)
+	}
+
+	// the child pod header is followed by the values.
+	if child := podOrder.Uint32(channels.body[4:]); child != podTypeFloat || len(channels.body) != podHeaderSize+2*podWordSize {
+		t.Fatalf("expected 2 floats, got type %d in %v", child, channels.body)
+	}
+
+	for i := range 2 {
+		if v := math.Float32frombits(podOrder.Uint32(channels.body[podHeaderSize+i*podWordSize:])); v != 0.25 {
+			t.Fatalf("expected channel %d at 0.25, got %g", i, v)
+		}
+	}
+
+	wait(t, errs)
+}
+
+func TestPing(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+
+	conn, _ := connect(t, s, c, 42)
+
+	conn.ping(t, 7)
+	conn.ping(t, 8)
+}
+
+func TestRemoveIDFreesProxy(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+
+	conn, id := connect(t, s, c, 42)
+
+	conn.send(t, coreID, coreEventRemoveID, func(b *podBuilder) {
+		b.Int(int32(id))
+	})
+	conn.ping(t, 1)
+
+	// the node has to be bound again, reusing the freed id.
+	errs := async(func() error {
+		return c.SetNodeVolume(context.Background(), 43, 0.25, 0)
+	})
+
+	if newID := conn.bind(t, 43); newID != id {
+		t.Fatalf("expected freed id %d to be reused, got %d", id, newID)
+	}
+
+	conn.readProps(t, id)
+	wait(t, errs)
+}
+
+func TestReconnect(t *testing.T) {
+	s := newFakeServer(t)
+	c := NewClient()
+
+	conn, _ := connect(t, s, c, 42)
+
+	c.Lock()
+	gone := c.gone
+	c.Unlock()
+
+	conn.conn.Close()
+
+	select {
+	case <-gone:
+	case <-time.After(testTimeout):
+		t.Fatal("client did not notice the closed socket")
+	}
+
+	// the next call connects again, binding the node anew.
+	_, id := connect(t, s, c, 42)
+
+	if id != firstID {
+		t.Fatalf("expected ids to start over, got %d", id)
+	}
+}
@@ -2,31 +2,68 @@ package pipewire
 
 import (
 	"context"
-	"fmt"
-	"os/exec"
 
 	"github.com/joomcode/errorx"
 	"github.com/rs/zerolog"
 )
 
 type Node struct {
-	PortID int
-	ID     int
-	Binary string
+	client *Client
+
+	ID          int
+	Name        string
+	Description string
+	Binary      string
+	// Props holds all properties of the node, i.e. media.role or pipewire.access.portal.app_id.
+	Props Props `json:"-"`
+	// Channels is the number of channel volumes of the node, 0 if it has none or they are not known yet.
+	Channels int
+}
+
+// NewNode creates a node controlled through client from a registry object.
+func NewNode(client *Client, obj *Object) *Node {
+	props := obj.Props()
+
+	volume, _ := obj.Volume()
+
+	name := props.String("application.process.binary")
+	if len(name) == 0 {
+		name = props.String("application.name")
+	}
+
+	return &Node{
+		client:      client,
+		ID:          obj.ID,
+		Name:        props.String("node.name"),
+		Description: props.String("node.description"),
+		Binary:      name,
+		Props:       props,
+		Channels:    volume.Channels,
+	}
 }
 
+// SetVolume sets the volume the node plays at, see Volume.Effective.
 func (n *Node) SetVolume(ctx context.Context, v float32) error {
 	logger := zerolog.Ctx(ctx)
 
 	logger.Trace().Str("binary", n.Binary).Int("id", n.ID).Float32("volume", v).Msg("setting volume")
 
-	vstring := fmt.Sprintf("'{ volume: %.6f }'", v)
+	err := n.client.SetNodeVolume(ctx, n.ID, v, n.Channels)
+	if err != nil {
+		return errorx.Decorate(err, "set node volume")
+	}
+
+	return nil
+}
+
+func (n *Node) SetMute(ctx context.Context, mute bool) error {
+	logger := zerolog.Ctx(ctx)
 
-	cmd := exec.CommandContext(ctx, "sh", "-c", fmt.Sprintf("pw-cli s %d Props '%s'", n.ID, vstring))
+	logger.Trace().Str("binary", n.Binary).Int("id", n.ID).Bool("mute", mute).Msg("setting mute")
 
-	err := cmd.Run()
+	err := n.client.SetNodeMute(ctx, n.ID, mute)
 	if err != nil {
-		return errorx.Decorate(err, "run command")
+		return errorx.Decorate(err, "set node mute")
 	}
 
 	return nil
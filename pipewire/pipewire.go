@@ -1,256 +1,435 @@
 package pipewire
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"os/exec"
+	"slices"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/joomcode/errorx"
 	"github.com/rs/zerolog"
 )
 
 const (
-	pwTypeNode         = "PipeWire:Interface:Node"
-	pwMediaClassOutput = "Stream/Output/Audio"
-
-	pwTypePort = "PipeWire:Interface:Port"
+	TypeNode     = "PipeWire:Interface:Node"
+	TypePort     = "PipeWire:Interface:Port"
+	TypeLink     = "PipeWire:Interface:Link"
+	TypeDevice   = "PipeWire:Interface:Device"
+	TypeClient   = "PipeWire:Interface:Client"
+	TypeMetadata = "PipeWire:Interface:Metadata"
+
+	MediaClassOutput = "Stream/Output/Audio"
+	MediaClassInput  = "Stream/Input/Audio"
+	MediaClassSink   = "Audio/Sink"
+	MediaClassSource = "Audio/Source"
+
+	MetadataDefault  = "default"
+	KeyDefaultSink   = "default.audio.sink"
+	KeyDefaultSource = "default.audio.source"
+	// the configured default is what the session manager persists and prefers as long as the node exists.
+	KeyConfiguredSink   = "default.configured.audio.sink"
+	KeyConfiguredSource = "default.configured.audio.source"
 
 	ActionAdd    = "add"
+	ActionChange = "change"
 	ActionRemove = "remove"
 
-	bufferSize = 256
+	restartDelay = 1 * time.Second
 )
 
 type Action string
 
+// Props holds object properties as printed by pw-dump,
+// which turns numeric and boolean looking values into json numbers and booleans.
+type Props map[string]any
+
+func (p Props) String(key string) string {
+	switch v := p[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+
+		return string(b)
+	}
+}
+
+func (p Props) Int(key string) (int, bool) {
+	switch v := p[key].(type) {
+	case float64:
+		return int(v), true
+	case string:
+		i, err := strconv.Atoi(v)
+
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+type MetadataEntry struct {
+	Subject int             `json:"subject"`
+	Key     string          `json:"key"`
+	Type    string          `json:"type"`
+	Value   json.RawMessage `json:"value"`
+}
+
 type Object struct {
 	ID   int    `json:"id"`
 	Type string `json:"type"`
-	Info struct {
-		Props struct {
-			Name       string `json:"application.name"`
-			Binary     string `json:"application.process.binary"`
-			MediaClass string `json:"media.class"`
-			NodeID     int    `json:"node.id"`
-		} `json:"props"`
+	// metadata objects carry their props and entries outside of info.
+	MetaProps Props           `json:"props"`
+	Metadata  []MetadataEntry `json:"metadata"`
+	Info      *struct {
+		Props  Props `json:"props"`
 		Params struct {
 			Props []struct {
-				Volume float32 `json:"volume"`
+				Volume         *float32  `json:"volume"`
+				Mute           *bool     `json:"mute"`
+				ChannelVolumes []float32 `json:"channelVolumes"`
 			} `json:"props"`
 		} `json:"params"`
 	} `json:"info"`
 }
 
-type Dump []Object
+func (o *Object) Props() Props {
+	if o.Info == nil {
+		return o.MetaProps
+	}
 
-type Port struct {
-	ID int
+	return o.Info.Props
 }
 
-type Event struct {
-	Port   Port
-	Action Action
+// Volume is the volume and mute state of a node.
+type Volume struct {
+	// Volume is the volume prop.
+	Volume float32
+	// Channel is the loudest of the channel volumes, which are what mixers like pavucontrol change.
+	Channel float32
+	// Channels is the number of channel volumes, 0 if the node only has the volume prop.
+	Channels int
+	Muted    bool
 }
 
-type PWMonitor struct {
-	cmd    *exec.Cmd
-	events chan Event
+// Effective returns the volume the node plays at, combining its volume prop and channel volumes.
+// It is the volume Node.SetVolume sets.
+func (v Volume) Effective() float32 {
+	return v.Volume * v.Channel
 }
 
-func MonitorOutputs(ctx context.Context) (chan Event, error) {
-	pwm := PWMonitor{
-		cmd:    nil,
-		events: make(chan Event),
+// Volume returns the volume of a node. Returns false if the node has no volume props.
+func (o *Object) Volume() (Volume, bool) {
+	if o.Info == nil {
+		return Volume{}, false
 	}
 
-	go pwm.run(ctx)
+	for _, props := range o.Info.Params.Props {
+		if props.Volume == nil && props.ChannelVolumes == nil {
+			continue
+		}
 
-	return pwm.events, nil
-}
+		volume := Volume{Volume: 1, Channel: 1, Channels: len(props.ChannelVolumes), Muted: props.Mute != nil && *props.Mute}
 
-func (pwm *PWMonitor) run(ctx context.Context) {
-	logger := zerolog.Ctx(ctx)
+		if props.Volume != nil {
+			volume.Volume = *props.Volume
+		}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
+		if len(props.ChannelVolumes) > 0 {
+			volume.Channel = slices.Max(props.ChannelVolumes)
 		}
 
-		cmd := exec.CommandContext(ctx, "pw-link", "-Iom")
+		return volume, true
+	}
 
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			logger.Error().Err(err).Msg("get stdout pipe")
+	return Volume{}, false
+}
 
+// MetadataName returns the name stored under key for subject 0,
+// the way the session manager stores default nodes, i.e. { "name": "alsa_output..." }.
+func (o *Object) MetadataName(key string) string {
+	for _, entry := range o.Metadata {
+		if entry.Subject != 0 || entry.Key != key {
 			continue
 		}
 
-		err = cmd.Start()
-		if err != nil {
-			logger.Error().Err(err).Msg("start command")
+		var value struct {
+			Name string `json:"name"`
+		}
 
-			continue
+		err := json.Unmarshal(entry.Value, &value)
+		if err == nil {
+			return value.Name
 		}
 
-		go pwm.parseMonitorOutputs(ctx, stdout)
+		// some versions print json values as strings.
+		var raw string
 
-		err = cmd.Wait()
-		if err == nil {
-			logger.Error().Err(err).Msg("wait for command")
+		err = json.Unmarshal(entry.Value, &raw)
+		if err != nil {
+			return ""
 		}
 
-		logger.Debug().Msg("pw-link has exited")
+		err = json.Unmarshal([]byte(raw), &value)
+		if err != nil {
+			return ""
+		}
 
-		pwm.close(logger.With().Logger())
+		return value.Name
 	}
+
+	return ""
 }
 
-func (pwm *PWMonitor) parseMonitorOutputs(ctx context.Context, stream io.Reader) {
-	logger := zerolog.Ctx(ctx)
+// SetDefaultNode makes the node with the given name the configured default stored under key, i.e. KeyConfiguredSink.
+func SetDefaultNode(ctx context.Context, key, name string) error {
+	value, err := json.Marshal(struct {
+		Name string `json:"name"`
+	}{Name: name})
+	if err != nil {
+		return errorx.Decorate(err, "marshal value")
+	}
+
+	//nolint:gosec // arguments are not interpreted by a shell.
+	out, err := exec.CommandContext(
+		ctx, "pw-metadata", "-n", MetadataDefault, "0", key, string(value), "Spa:String:JSON",
+	).CombinedOutput()
+	if err != nil {
+		return errorx.Decorate(err, "run pw-metadata: %s", out)
+	}
+
+	return nil
+}
 
-	bs := bufio.NewScanner(stream)
+type Event struct {
+	Action Action
+	Object *Object
+}
 
-	bs.Buffer(nil, bufferSize)
+// Registry mirrors the pipewire object registry using a single long-lived pw-dump --monitor process.
+type Registry struct {
+	sync.RWMutex `exhaustruct:"optional"`
 
-	for bs.Scan() {
-		line := bs.Bytes()
+	objects map[int]*Object
 
-		// we need first 6 bytes.
-		if len(line) < 6 {
-			continue
-		}
+	Events chan Event
+}
 
-		var action Action
+func MonitorRegistry(ctx context.Context) (*Registry, error) {
+	r := &Registry{
+		objects: make(map[int]*Object),
 
-		actionSymbol := line[0]
-		switch actionSymbol {
-		case '+', '=':
-			action = ActionAdd
-		case '-':
-			action = ActionRemove
-		default:
-			continue
-		}
+		Events: make(chan Event),
+	}
 
-		oidb := line[1:6]
+	go r.run(ctx)
 
-		oid, err := strconv.Atoi(string(bytes.TrimSpace(oidb)))
-		if err != nil {
-			logger.Error().Err(err).Msg("parse object id")
+	return r, nil
+}
+
+// Object returns the object with the given id.
+func (r *Registry) Object(id int) (*Object, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	obj, ok := r.objects[id]
+
+	return obj, ok
+}
 
+// DefaultNodeName returns the name of the default node stored under key, i.e. KeyDefaultSink.
+func (r *Registry) DefaultNodeName(key string) string {
+	for _, obj := range r.Objects(TypeMetadata) {
+		if obj.Props().String("metadata.name") != MetadataDefault {
 			continue
 		}
 
-		pwm.events <- Event{
-			Action: action,
-			Port:   Port{ID: oid},
+		if name := obj.MetadataName(key); name != "" {
+			return name
 		}
 	}
-}
 
-func GetPortNode(ctx context.Context, oid int) (*Node, error) {
-	logger := zerolog.Ctx(ctx).With().Int("oid", oid).Logger()
+	return ""
+}
 
-	dump, err := getObjectInfo(ctx, oid)
-	if err != nil {
-		logger.Error().Err(err).Msg("get object info")
-	}
+// Objects returns all objects of the given type, i.e. TypeNode.
+func (r *Registry) Objects(typ string) []*Object {
+	r.RLock()
+	defer r.RUnlock()
 
-	var obj *Object
+	objs := make([]*Object, 0)
 
-	for _, pot := range dump {
-		if pot.ID == oid && pot.Type == pwTypePort && pot.Info.Props.NodeID != 0 {
-			obj = &pot
+	for _, obj := range r.objects {
+		if obj.Type == typ {
+			objs = append(objs, obj)
 		}
 	}
 
-	if obj == nil {
-		return nil, errorx.IllegalState.New("failed to get port object")
-	}
-
-	dump, err = getObjectInfo(ctx, obj.Info.Props.NodeID)
-	if err != nil {
-		return nil, errorx.Decorate(err, "get node object")
-	}
+	return objs
+}
 
-	var node *Object
+func (r *Registry) run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
 
-	for _, pot := range dump {
-		if pot.ID == obj.Info.Props.NodeID && pot.Type == pwTypeNode && pot.Info.Props.MediaClass == pwMediaClassOutput {
-			node = &pot
+	for {
+		err := r.monitor(ctx)
+		if err != nil {
+			logger.Error().Err(err).Msg("monitor pw-dump")
 		}
-	}
 
-	if node == nil {
-		return nil, errorx.IllegalState.New("failed to get node object")
-	}
+		logger.Debug().Msg("pw-dump has exited")
 
-	name := node.Info.Props.Binary
-	if len(name) == 0 {
-		name = node.Info.Props.Name
-	}
+		// everything is going to be re-announced by the next pw-dump.
+		r.clear(ctx)
 
-	return &Node{
-		PortID: oid,
-		ID:     node.ID,
-		Binary: name,
-	}, nil
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
 }
 
-func getObjectInfo(ctx context.Context, oid int) (Dump, error) {
-	cmd := exec.CommandContext(ctx, "pw-dump", strconv.Itoa(oid))
+func (r *Registry) monitor(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "pw-dump", "--monitor")
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, errorx.Decorate(err, "get stdout pipe")
+		return errorx.Decorate(err, "get stdout pipe")
 	}
 
 	err = cmd.Start()
 	if err != nil {
-		return nil, errorx.Decorate(err, "start command")
+		return errorx.Decorate(err, "start command")
 	}
 
-	b, err := io.ReadAll(stdout)
+	err = r.parseDump(ctx, stdout)
 	if err != nil {
-		return nil, errorx.Decorate(err, "read stdout")
+		return errorx.Decorate(errors.Join(err, cmd.Wait()), "parse dump")
 	}
 
 	err = cmd.Wait()
 	if err != nil {
-		return nil, errorx.Decorate(err, "wait for command")
+		return errorx.Decorate(err, "wait for command")
 	}
 
-	var dump Dump
+	return nil
+}
+
+func (r *Registry) parseDump(ctx context.Context, stream io.Reader) error {
+	dec := json.NewDecoder(stream)
 
-	err = json.Unmarshal(b, &dump)
-	if err != nil {
-		return nil, errorx.Decorate(err, "unmarshal data")
+	for {
+		var dump []*Object
+
+		err := dec.Decode(&dump)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return errorx.Decorate(err, "decode dump")
+		}
+
+		for _, obj := range dump {
+			r.update(ctx, obj)
+		}
 	}
+}
+
+func (r *Registry) update(ctx context.Context, obj *Object) {
+	r.Lock()
 
-	return dump, nil
+	old, exists := r.objects[obj.ID]
+
+	var event Event
+
+	switch {
+	// removals are printed as the id with null info and no type.
+	case obj.Type == "":
+		if !exists {
+			r.Unlock()
+
+			return
+		}
+
+		delete(r.objects, obj.ID)
+
+		event = Event{Action: ActionRemove, Object: old}
+	case exists:
+		if obj.Type == TypeMetadata {
+			mergeMetadata(old, obj)
+		}
+
+		r.objects[obj.ID] = obj
+
+		event = Event{Action: ActionChange, Object: obj}
+	default:
+		r.objects[obj.ID] = obj
+
+		event = Event{Action: ActionAdd, Object: obj}
+	}
+
+	r.Unlock()
+
+	select {
+	case <-ctx.Done():
+	case r.Events <- event:
+	}
 }
 
-func (pwm *PWMonitor) close(logger zerolog.Logger) {
-	if pwm.cmd == nil {
-		return
+func (r *Registry) clear(ctx context.Context) {
+	r.Lock()
+
+	objects := r.objects
+	r.objects = make(map[int]*Object)
+
+	r.Unlock()
+
+	for _, obj := range objects {
+		select {
+		case <-ctx.Done():
+			return
+		case r.Events <- Event{Action: ActionRemove, Object: obj}:
+		}
 	}
+}
 
-	err := pwm.cmd.Wait()
-	if err != nil {
-		logger.Error().Err(err).Msg("wait for pw-dump command")
+// mergeMetadata adds entries of old that are not updated in obj to obj,
+// since metadata updates only carry the changed entries. null values mean the entry was removed.
+func mergeMetadata(old, obj *Object) {
+	if obj.MetaProps == nil {
+		obj.MetaProps = old.MetaProps
 	}
 
-	pwm.cmd = nil
+	entries := make([]MetadataEntry, 0, len(old.Metadata)+len(obj.Metadata))
 
-	if pwm.events != nil {
-		close(pwm.events)
+	for _, entry := range old.Metadata {
+		updated := slices.ContainsFunc(obj.Metadata, func(e MetadataEntry) bool {
+			return e.Subject == entry.Subject && e.Key == entry.Key
+		})
+
+		if !updated {
+			entries = append(entries, entry)
+		}
+	}
+
+	for _, entry := range obj.Metadata {
+		if string(entry.Value) != "null" {
+			entries = append(entries, entry)
+		}
 	}
 
-	pwm.events = nil
+	obj.Metadata = entries
 }
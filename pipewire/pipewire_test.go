@@ -0,0 +1,136 @@
+package pipewire
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// successive dumps as printed by pw-dump --monitor, the first one with all objects, later ones with the changes.
+const testDump = `[
+  {
+    "id": 40,
+    "type": "PipeWire:Interface:Metadata",
+    "props": { "metadata.name": "default" },
+    "metadata": [
+      { "subject": 0, "key": "default.audio.sink", "type": "Spa:String:JSON", "value": { "name": "sink_a" } },
+      { "subject": 0, "key": "default.configured.audio.sink", "type": "Spa:String:JSON", "value": { "name": "sink_a" } }
+    ]
+  },
+  {
+    "id": 50,
+    "type": "PipeWire:Interface:Node",
+    "info": {
+      "props": { "node.name": "sink_a", "media.class": "Audio/Sink", "object.serial": 50 },
+      "params": { "Props": [ { "volume": 0.5, "mute": false, "channelVolumes": [ 0.8, 0.4 ] } ] }
+    }
+  },
+  {
+    "id": 60,
+    "type": "PipeWire:Interface:Node",
+    "info": {
+      "props": { "application.process.binary": "spotify", "media.class": "Stream/Output/Audio" },
+      "params": { "Props": [ { "volume": 1.0, "mute": true } ] }
+    }
+  }
+]
+[
+  {
+    "id": 40,
+    "type": "PipeWire:Interface:Metadata",
+    "metadata": [
+      { "subject": 0, "key": "default.audio.sink", "type": "Spa:String:JSON", "value": "{ \"name\": \"sink_b\" }" }
+    ]
+  }
+]
+[
+  {
+    "id": 40,
+    "type": "PipeWire:Interface:Metadata",
+    "metadata": [
+      { "subject": 0, "key": "default.configured.audio.sink", "type": null, "value": null }
+    ]
+  },
+  { "id": 60, "info": null },
+  { "id": 70, "info": null }
+]
+`
+
+func TestParseDump(t *testing.T) {
+	r := &Registry{
+		objects: make(map[int]*Object),
+
+		Events: make(chan Event, 16),
+	}
+
+	err := r.parseDump(context.Background(), strings.NewReader(testDump))
+	if err != nil {
+		t.Fatalf("parse dump: %v", err)
+	}
+
+	close(r.Events)
+
+	expected := []struct {
+		action Action
+		id     int
+	}{
+		{action: ActionAdd, id: 40},
+		{action: ActionAdd, id: 50},
+		{action: ActionAdd, id: 60},
+		{action: ActionChange, id: 40},
+		{action: ActionChange, id: 40},
+		// removing the unknown object 70 is not an event.
+		{action: ActionRemove, id: 60},
+	}
+
+	events := make([]Event, 0)
+
+	for event := range r.Events {
+		events = append(events, event)
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+
+	for i, event := range events {
+		if event.Action != expected[i].action || event.Object.ID != expected[i].id {
+			t.Errorf("event %d: expected %s of %d, got %s of %d",
+				i, expected[i].action, expected[i].id, event.Action, event.Object.ID)
+		}
+	}
+
+	// the removal carries the removed object.
+	if binary := events[5].Object.Props().String("application.process.binary"); binary != "spotify" {
+		t.Errorf("expected the removed stream, got %q", binary)
+	}
+
+	if _, ok := r.Object(60); ok {
+		t.Error("expected the removed stream to be gone")
+	}
+
+	// the changed default sink is merged, printed as a string by some versions, and the removed entry is dropped.
+	if name := r.DefaultNodeName(KeyDefaultSink); name != "sink_b" {
+		t.Errorf("expected default sink sink_b, got %q", name)
+	}
+
+	if name := r.DefaultNodeName(KeyConfiguredSink); name != "" {
+		t.Errorf("expected the configured sink to be removed, got %q", name)
+	}
+
+	metadata, _ := r.Object(40)
+	if len(metadata.Metadata) != 1 || metadata.Props().String("metadata.name") != MetadataDefault {
+		t.Errorf("expected the props and one entry to be kept, got %+v", metadata)
+	}
+
+	sink, _ := r.Object(50)
+
+	volume, ok := sink.Volume()
+	if !ok || volume.Volume != 0.5 || volume.Channel != 0.8 || volume.Channels != 2 || volume.Muted {
+		t.Errorf("unexpected sink volume %+v", volume)
+	}
+
+	if effective := volume.Effective(); effective != 0.4 {
+		t.Errorf("expected the sink to play at 0.4, got %g", effective)
+	}
+}
@@ -0,0 +1,217 @@
+package pipewire
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/joomcode/errorx"
+)
+
+// SPA POD types, see spa/utils/type.h.
+const (
+	podTypeNone   = 1
+	podTypeBool   = 2
+	podTypeID     = 3
+	podTypeInt    = 4
+	podTypeFloat  = 6
+	podTypeString = 8
+	podTypeArray  = 13
+	podTypeStruct = 14
+	podTypeObject = 15
+
+	podHeaderSize = 8
+	podAlign      = 8
+	podWordSize   = 4
+)
+
+var errMalformedPod = errorx.IllegalFormat.New("malformed pod")
+
+//nolint:gochecknoglobals // endianness of the native protocol is the host one.
+var podOrder = binary.NativeEndian
+
+func podPadding(size int) int {
+	return (podAlign - size%podAlign) % podAlign
+}
+
+// podBuilder writes SPA PODs into a byte buffer.
+type podBuilder struct {
+	buf []byte
+}
+
+func (b *podBuilder) header(size, typ uint32) {
+	b.buf = podOrder.AppendUint32(b.buf, size)
+	b.buf = podOrder.AppendUint32(b.buf, typ)
+}
+
+func (b *podBuilder) pad() {
+	b.buf = append(b.buf, make([]byte, podPadding(len(b.buf)))...)
+}
+
+func (b *podBuilder) Int(v int32) {
+	b.header(podWordSize, podTypeInt)
+	b.buf = podOrder.AppendUint32(b.buf, uint32(v))
+	b.pad()
+}
+
+func (b *podBuilder) Bool(v bool) {
+	var i uint32
+	if v {
+		i = 1
+	}
+
+	b.header(podWordSize, podTypeBool)
+	b.buf = podOrder.AppendUint32(b.buf, i)
+	b.pad()
+}
+
+func (b *podBuilder) ID(v uint32) {
+	b.header(podWordSize, podTypeID)
+	b.buf = podOrder.AppendUint32(b.buf, v)
+	b.pad()
+}
+
+func (b *podBuilder) Float(v float32) {
+	b.header(podWordSize, podTypeFloat)
+	b.buf = podOrder.AppendUint32(b.buf, math.Float32bits(v))
+	b.pad()
+}
+
+func (b *podBuilder) String(s string) {
+	b.header(uint32(len(s)+1), podTypeString)
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	b.pad()
+}
+
+// FloatArray writes an array pod of floats.
+func (b *podBuilder) FloatArray(vs []float32) {
+	b.header(uint32(podHeaderSize+len(vs)*podWordSize), podTypeArray)
+	b.header(podWordSize, podTypeFloat)
+
+	for _, v := range vs {
+		b.buf = podOrder.AppendUint32(b.buf, math.Float32bits(v))
+	}
+
+	b.pad()
+}
+
+// Struct writes a struct pod whose fields are written by f.
+func (b *podBuilder) Struct(f func()) {
+	b.container(podTypeStruct, f)
+}
+
+// Object writes an object pod whose properties are written by f using Prop.
+func (b *podBuilder) Object(objType, objID uint32, f func()) {
+	b.container(podTypeObject, func() {
+		b.buf = podOrder.AppendUint32(b.buf, objType)
+		b.buf = podOrder.AppendUint32(b.buf, objID)
+
+		f()
+	})
+}
+
+// Prop writes an object property header, the value pod has to follow it.
+func (b *podBuilder) Prop(key, flags uint32) {
+	b.buf = podOrder.AppendUint32(b.buf, key)
+	b.buf = podOrder.AppendUint32(b.buf, flags)
+}
+
+// Dict writes a dictionary the way pipewire marshals spa_dict.
+func (b *podBuilder) Dict(d map[string]string) {
+	b.Struct(func() {
+		b.Int(int32(len(d)))
+
+		for k, v := range d {
+			b.String(k)
+			b.String(v)
+		}
+	})
+}
+
+func (b *podBuilder) container(typ uint32, f func()) {
+	start := len(b.buf)
+
+	b.header(0, typ)
+
+	f()
+
+	podOrder.PutUint32(b.buf[start:], uint32(len(b.buf)-start-podHeaderSize))
+}
+
+// podReader reads SPA PODs sequentially from a byte buffer.
+type podReader struct {
+	buf []byte
+}
+
+func (r *podReader) next() (uint32, []byte, error) {
+	if len(r.buf) < podHeaderSize {
+		return 0, nil, errMalformedPod
+	}
+
+	size := int(podOrder.Uint32(r.buf))
+	typ := podOrder.Uint32(r.buf[podWordSize:])
+
+	if len(r.buf) < podHeaderSize+size {
+		return 0, nil, errMalformedPod
+	}
+
+	body := r.buf[podHeaderSize : podHeaderSize+size]
+
+	skip := min(podHeaderSize+size+podPadding(size), len(r.buf))
+	r.buf = r.buf[skip:]
+
+	return typ, body, nil
+}
+
+func (r *podReader) word(expected uint32) (uint32, error) {
+	typ, body, err := r.next()
+	if err != nil {
+		return 0, err
+	}
+
+	if typ != expected || len(body) < podWordSize {
+		return 0, errorx.IllegalFormat.New("expected pod type %d, got %d", expected, typ)
+	}
+
+	return podOrder.Uint32(body), nil
+}
+
+func (r *podReader) Int() (int32, error) {
+	v, err := r.word(podTypeInt)
+
+	return int32(v), err
+}
+
+// String reads a string pod, a none pod is read as an empty string.
+func (r *podReader) String() (string, error) {
+	typ, body, err := r.next()
+	if err != nil {
+		return "", err
+	}
+
+	switch typ {
+	case podTypeNone:
+		return "", nil
+	case podTypeString:
+		if len(body) == 0 {
+			return "", errMalformedPod
+		}
+
+		return string(body[:len(body)-1]), nil
+	default:
+		return "", errorx.IllegalFormat.New("expected string pod, got %d", typ)
+	}
+}
+
+func (r *podReader) Struct() (*podReader, error) {
+	typ, body, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if typ != podTypeStruct {
+		return nil, errorx.IllegalFormat.New("expected struct pod, got %d", typ)
+	}
+
+	return &podReader{buf: body}, nil
+}
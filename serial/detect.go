@@ -0,0 +1,206 @@
+package serial
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/joomcode/errorx"
+)
+
+const (
+	sysTTYDir = "/sys/class/tty"
+	byIDDir   = "/dev/serial/by-id"
+	devDir    = "/dev"
+
+	// usb device directories are a few levels above the tty device, stop looking after that.
+	maxUSBDepth = 4
+)
+
+// boards by genuine Arduino vendors are preferred when nothing else tells the candidates apart.
+//
+//nolint:gochecknoglobals // constant list.
+var arduinoVIDs = []string{"2341", "2a03"}
+
+// Match selects the serial port to use with config.SerialPortAuto. Empty fields match anything.
+type Match struct {
+	// VID and PID are hexadecimal USB vendor and product ids, i.e. 2341 or 0x2341.
+	VID string
+	PID string
+	// Serial is the exact USB serial number.
+	Serial string
+	// ByID is a glob matched against names in /dev/serial/by-id.
+	ByID string
+}
+
+type candidate struct {
+	dev    string
+	vid    string
+	pid    string
+	serial string
+	byID   []string
+}
+
+func (c candidate) String() string {
+	return c.dev + " (" + c.vid + ":" + c.pid + " serial " + c.serial + ")"
+}
+
+// Resolve returns the device of the only attached usb serial port matching m.
+func Resolve(m Match) (string, error) {
+	candidates, err := usbCandidates()
+	if err != nil {
+		return "", errorx.Decorate(err, "list usb serial ports")
+	}
+
+	matched := make([]candidate, 0, len(candidates))
+
+	for _, c := range candidates {
+		ok, err := m.matches(c)
+		if err != nil {
+			return "", err
+		}
+
+		if ok {
+			matched = append(matched, c)
+		}
+	}
+
+	if len(matched) > 1 {
+		arduinos := slices.DeleteFunc(slices.Clone(matched), func(c candidate) bool {
+			return !slices.Contains(arduinoVIDs, c.vid)
+		})
+
+		if len(arduinos) == 1 {
+			matched = arduinos
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return "", errorx.IllegalState.New("no usb serial port matches, found %v", candidates)
+	case 1:
+		return matched[0].dev, nil
+	default:
+		return "", errorx.IllegalState.New(
+			"several usb serial ports match, set usb_vid, usb_pid, usb_serial or serial_by_id to pick one of %v", matched,
+		)
+	}
+}
+
+func (m Match) matches(c candidate) (bool, error) {
+	if m.VID != "" && normalizeID(m.VID) != c.vid {
+		return false, nil
+	}
+
+	if m.PID != "" && normalizeID(m.PID) != c.pid {
+		return false, nil
+	}
+
+	if m.Serial != "" && m.Serial != c.serial {
+		return false, nil
+	}
+
+	if m.ByID == "" {
+		return true, nil
+	}
+
+	for _, name := range c.byID {
+		ok, err := filepath.Match(m.ByID, name)
+		if err != nil {
+			return false, errorx.Decorate(err, "match serial_by_id")
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func normalizeID(id string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(id)), "0x")
+}
+
+func usbCandidates() ([]candidate, error) {
+	entries, err := os.ReadDir(sysTTYDir)
+	if err != nil {
+		return nil, errorx.Decorate(err, "read %s", sysTTYDir)
+	}
+
+	byID := byIDNames()
+	candidates := make([]candidate, 0)
+
+	for _, entry := range entries {
+		device, err := filepath.EvalSymlinks(filepath.Join(sysTTYDir, entry.Name(), "device"))
+		if err != nil {
+			// virtual terminals have no device.
+			continue
+		}
+
+		usbDir, ok := findUSBDevice(device)
+		if !ok {
+			continue
+		}
+
+		dev := filepath.Join(devDir, entry.Name())
+
+		candidates = append(candidates, candidate{
+			dev:    dev,
+			vid:    normalizeID(readSysAttr(usbDir, "idVendor")),
+			pid:    normalizeID(readSysAttr(usbDir, "idProduct")),
+			serial: readSysAttr(usbDir, "serial"),
+			byID:   byID[dev],
+		})
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return strings.Compare(a.dev, b.dev)
+	})
+
+	return candidates, nil
+}
+
+// findUSBDevice returns the closest ancestor of dir describing a usb device.
+func findUSBDevice(dir string) (string, bool) {
+	for range maxUSBDepth {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir, true
+		}
+
+		dir = filepath.Dir(dir)
+	}
+
+	return "", false
+}
+
+func readSysAttr(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// byIDNames returns names of /dev/serial/by-id links by the device they point to.
+func byIDNames() map[string][]string {
+	names := make(map[string][]string)
+
+	entries, err := os.ReadDir(byIDDir)
+	if err != nil {
+		return names
+	}
+
+	for _, entry := range entries {
+		dev, err := filepath.EvalSymlinks(filepath.Join(byIDDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		names[dev] = append(names[dev], entry.Name())
+	}
+
+	return names
+}
@@ -0,0 +1,96 @@
+package serial
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+
+	"github.com/joomcode/errorx"
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ueventBufferSize = 8192
+	// kernel uevents multicast group, udev re-broadcasts them in its own format on group 2.
+	ueventKernelGroup = 1
+)
+
+// watchHotplug notifies the returned channel whenever a tty device is added.
+func watchHotplug(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := unix.Socket(
+		unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_KOBJECT_UEVENT,
+	)
+	if err != nil {
+		return nil, errorx.Decorate(err, "create netlink socket")
+	}
+
+	// non-blocking descriptors are read through the runtime poller, so closing the file unblocks reads.
+	f := os.NewFile(uintptr(fd), "uevent")
+
+	//nolint:exhaustruct
+	err = unix.Bind(fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: ueventKernelGroup,
+	})
+	if err != nil {
+		return nil, errorx.Decorate(errors.Join(err, f.Close()), "bind netlink socket")
+	}
+
+	added := make(chan struct{}, 1)
+
+	context.AfterFunc(ctx, func() {
+		err := f.Close()
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to close netlink socket")
+		}
+	})
+
+	go readUevents(ctx, f, added)
+
+	return added, nil
+}
+
+func readUevents(ctx context.Context, f *os.File, added chan<- struct{}) {
+	logger := zerolog.Ctx(ctx)
+
+	buf := make([]byte, ueventBufferSize)
+
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error().Err(err).Msg("Failed to read uevents")
+			}
+
+			return
+		}
+
+		if !isTTYAdd(buf[:n]) {
+			continue
+		}
+
+		logger.Debug().Msg("tty device added")
+
+		select {
+		case added <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// isTTYAdd parses a kernel uevent, which is a header followed by NUL separated KEY=value pairs.
+func isTTYAdd(msg []byte) bool {
+	var action, subsystem []byte
+
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		if v, ok := bytes.CutPrefix(field, []byte("ACTION=")); ok {
+			action = v
+		} else if v, ok := bytes.CutPrefix(field, []byte("SUBSYSTEM=")); ok {
+			subsystem = v
+		}
+	}
+
+	return string(action) == "add" && string(subsystem) == "tty"
+}
@@ -0,0 +1,207 @@
+package serial
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/joomcode/errorx"
+)
+
+// The board sends one line per reading with the raw values of all sliders separated by pipes, i.e. "0|512|1023".
+// Any other line starts with a message type, which starts with a letter, fields are separated by pipes as well.
+// Lines are terminated by "\n" in both directions, and both sides should ignore message types they do not know.
+//
+// The handshake is optional, boards without it keep working with plain readings.
+// deej sends its protocol version right after connecting,
+//
+//	H|<protocol>
+//
+// and the board answers, or sends on its own after starting up, what it has:
+//
+//	H|<protocol>|<sliders>|<adc max>[|<buttons>[|<encoders>]]
+//
+// i.e. "H|1|5|1023|2|0" for protocol 1, 5 sliders read with a 10 bit ADC, 2 buttons and no encoders.
+// After a handshake deej sizes the mapping from it, and only accepts readings with exactly <sliders> values.
+// The handshake is forgotten when the board disconnects.
+//
+// Boards with buttons send
+//
+//	B|<button>|<pressed>
+//
+// i.e. "B|0|1" when the first button is pressed and "B|0|0" when it is released.
+// <button> is the zero-based button index, actions are triggered on press.
+//
+// Boards with rotary encoders send the detents turned since the last message, negative ones counterclockwise,
+// and press and release events of their push buttons:
+//
+//	E|<encoder>|<steps>
+//	P|<encoder>|<pressed>
+//
+// i.e. "E|0|-2" after turning the first encoder two detents down, and "P|0|1" when pushing it.
+//
+// deej reports volumes to the board with
+//
+//	V|<slider>|<value>|<muted>
+//
+// i.e. "V|1|512|0", after volumes of the targets of a slider changed other than by moving it, i.e. in a mixer.
+// Volumes are the ones the targets play at, so a slider set to <value> is reported at <value> again,
+// and changes within half a second of the slider moving are not reported, since they are its own.
+// <slider> is the zero-based slider index, <value> uses the same scale as the readings of the board
+// and is already inverted for inverted sliders, <muted> is 1 if all targets are muted and 0 otherwise.
+// Boards with motorized faders, LED rings or displays can use it to show the real volume.
+// Volumes of every slider are sent again after the board is (re)connected.
+const (
+	ProtocolVersion = 1
+
+	MessageHandshake = "H"
+	MessageButton    = "B"
+	MessageEncoder   = "E"
+	MessagePush      = "P"
+	MessageVolume    = "V"
+
+	fieldSeparator = "|"
+
+	// protocol, sliders and adc max are required in a handshake from the board, buttons and encoders are optional.
+	handshakeMinValues = 3
+	handshakeValues    = 5
+	buttonValues       = 2
+	encoderValues      = 2
+)
+
+// Handshake describes the board as announced by it.
+type Handshake struct {
+	Protocol int
+	Sliders  int
+	ADCMax   int
+	Buttons  int
+	Encoders int
+}
+
+// MessageType returns the type of a line sent by the board, or an empty string for readings.
+// Lines not starting with a letter are readings, so that signed and fractional ones like "-3|.5" are parsed as such.
+func MessageType(line []byte) string {
+	line = bytes.TrimSpace(line)
+
+	if len(line) == 0 || !isLetter(line[0]) {
+		return ""
+	}
+
+	typ, _, _ := bytes.Cut(line, []byte(fieldSeparator))
+
+	return string(typ)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// ParseHandshake parses a handshake line sent by the board.
+func ParseHandshake(line []byte) (Handshake, error) {
+	values, err := parseValues(line, MessageHandshake, false)
+	if err != nil {
+		return Handshake{}, err
+	}
+
+	if len(values) < handshakeMinValues {
+		return Handshake{}, errorx.IllegalFormat.New("handshake has %d values, expected at least %d", len(values), handshakeMinValues)
+	}
+
+	// optional values default to zero.
+	values = append(values, make([]int, max(0, handshakeValues-len(values)))...)
+
+	h := Handshake{
+		Protocol: values[0],
+		Sliders:  values[1],
+		ADCMax:   values[2],
+		Buttons:  values[3],
+		Encoders: values[4],
+	}
+
+	if h.Sliders == 0 {
+		return Handshake{}, errorx.IllegalFormat.New("handshake has no sliders")
+	}
+
+	if h.ADCMax == 0 {
+		return Handshake{}, errorx.IllegalFormat.New("handshake has zero adc max")
+	}
+
+	return h, nil
+}
+
+// ParseButton parses a button event sent by the board, returning the button index and whether it was pressed.
+func ParseButton(line []byte) (int, bool, error) {
+	return parseEvent(line, MessageButton)
+}
+
+// ParsePush parses an encoder push event sent by the board, returning the encoder index and whether it was pressed.
+func ParsePush(line []byte) (int, bool, error) {
+	return parseEvent(line, MessagePush)
+}
+
+// ParseEncoder parses an encoder event sent by the board, returning the encoder index and the detents turned.
+func ParseEncoder(line []byte) (int, int, error) {
+	values, err := parseValues(line, MessageEncoder, true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(values) != encoderValues {
+		return 0, 0, errorx.IllegalFormat.New("encoder event has %d values, expected %d", len(values), encoderValues)
+	}
+
+	if values[0] < 0 {
+		return 0, 0, errorx.IllegalFormat.New("negative encoder index %d", values[0])
+	}
+
+	return values[0], values[1], nil
+}
+
+func parseEvent(line []byte, typ string) (int, bool, error) {
+	values, err := parseValues(line, typ, false)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(values) != buttonValues {
+		return 0, false, errorx.IllegalFormat.New("%s event has %d values, expected %d", typ, len(values), buttonValues)
+	}
+
+	return values[0], values[1] != 0, nil
+}
+
+// parseValues returns the integer fields of a message of type typ, which have to be non-negative unless signed is set.
+func parseValues(line []byte, typ string, signed bool) ([]int, error) {
+	fields := bytes.Split(bytes.TrimSpace(line), []byte(fieldSeparator))
+
+	if string(fields[0]) != typ {
+		return nil, errorx.IllegalArgument.New("not a %s message: %q", typ, line)
+	}
+
+	values := make([]int, len(fields)-1)
+
+	for i, field := range fields[1:] {
+		v, err := strconv.Atoi(string(bytes.TrimSpace(field)))
+		if err != nil || (v < 0 && !signed) {
+			return nil, errorx.IllegalFormat.New("invalid field %d of %s message: %q", i+1, typ, field)
+		}
+
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// FormatHandshake returns the handshake deej sends after connecting.
+func FormatHandshake() []byte {
+	return []byte(MessageHandshake + fieldSeparator + strconv.Itoa(ProtocolVersion))
+}
+
+// FormatVolume returns a volume message for the slider with index idx.
+func FormatVolume(idx, value int, muted bool) []byte {
+	mute := "0"
+	if muted {
+		mute = "1"
+	}
+
+	return []byte(MessageVolume + fieldSeparator + strconv.Itoa(idx) + fieldSeparator + strconv.Itoa(value) + fieldSeparator + mute)
+}
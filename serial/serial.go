@@ -2,11 +2,16 @@ package serial
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"io"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/joomcode/errorx"
+	"github.com/omriharel/deej/config"
 	"github.com/rs/zerolog"
 	"github.com/tarm/serial"
 )
@@ -14,48 +19,112 @@ import (
 const (
 	readTimeout = 500 * time.Millisecond
 
-	reconnectAttempts = 10
-	reconnectDelay    = 1 * time.Second
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+	// udev needs a moment to set up permissions of a freshly added device.
+	hotplugSettleDelay = 200 * time.Millisecond
+
+	StateConnected    State = "connected"
+	StateDisconnected State = "disconnected"
 )
 
+type State string
+
+var ErrNotConnected = errorx.IllegalState.New("serial port is not connected")
+
 type Serial struct {
+	sync.Mutex `exhaustruct:"optional"`
+
 	baudRate int
 	port     string
+	match    Match
+
+	f     io.ReadWriteCloser
+	state State
 
-	f io.ReadCloser
+	stateFuncs []func(context.Context, State)
 
-	Errors chan error
-	Lines  chan []byte
+	Lines chan []byte
 }
 
-func NewSerial(port string, baudRate int) *Serial {
+// NewSerial creates a connection to port, or to the usb serial port selected by match if port is config.SerialPortAuto.
+func NewSerial(port string, baudRate int, match Match) *Serial {
 	return &Serial{
 		baudRate: baudRate,
 		port:     port,
+		match:    match,
+
+		f:     nil,
+		state: "",
 
-		f: nil,
+		stateFuncs: make([]func(context.Context, State), 0),
 
-		Errors: make(chan error),
-		Lines:  make(chan []byte),
+		Lines: make(chan []byte),
 	}
 }
 
-func (s *Serial) Run(ctx context.Context) error {
-	// do the first connection loudly to catch any errors.
-	err := s.open()
+// OnState registers f to be called on every connection state change.
+func (s *Serial) OnState(f func(context.Context, State)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stateFuncs = append(s.stateFuncs, f)
+}
+
+// Run keeps the serial port connected and reads lines from it until ctx is done.
+// While the board is unplugged it retries with exponential backoff, and right away when a tty device is added.
+func (s *Serial) Run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	hotplug, err := watchHotplug(ctx)
 	if err != nil {
-		return errorx.Decorate(err, "to open serial port")
+		logger.Warn().Err(err).Msg("Failed to watch for hotplug events, relying on periodic reconnects")
 	}
 
-	go s.run(ctx)
+	go s.run(ctx, hotplug)
+
+	// closing the port unblocks the pending read.
+	context.AfterFunc(ctx, func() {
+		s.close(logger.With().Logger())
+	})
+}
+
+// Write sends line to the board, appending the line terminator.
+// Returns ErrNotConnected while the board is not connected.
+func (s *Serial) Write(line []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.f == nil {
+		return ErrNotConnected
+	}
+
+	_, err := s.f.Write(append(slices.Clip(line), '\n'))
+	if err != nil {
+		return errorx.Decorate(err, "write to serial port")
+	}
 
 	return nil
 }
 
-func (s *Serial) open() error {
+func (s *Serial) open(ctx context.Context) error {
+	name := s.port
+
+	// resolve on every open, since the device name may change when the board is replugged.
+	if name == config.SerialPortAuto {
+		var err error
+
+		name, err = Resolve(s.match)
+		if err != nil {
+			return errorx.Decorate(err, "resolve serial port")
+		}
+
+		zerolog.Ctx(ctx).Debug().Str("port", name).Msg("Resolved serial port")
+	}
+
 	//nolint:exhaustruct
 	sp, err := serial.OpenPort(&serial.Config{
-		Name:        s.port,
+		Name:        name,
 		Baud:        s.baudRate,
 		ReadTimeout: readTimeout,
 	})
@@ -63,56 +132,145 @@ func (s *Serial) open() error {
 		return errorx.Decorate(err, "failed to open serial port")
 	}
 
+	s.Lock()
+
 	s.f = sp
 
+	s.Unlock()
+
 	return nil
 }
 
-func (s *Serial) run(ctx context.Context) {
+func (s *Serial) close(logger zerolog.Logger) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.f == nil {
+		return
+	}
+
+	err := s.f.Close()
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to close serial port")
+	}
+
+	s.f = nil
+}
+
+func (s *Serial) setState(ctx context.Context, state State) {
+	s.Lock()
+
+	if s.state == state {
+		s.Unlock()
+
+		return
+	}
+
+	s.state = state
+	funcs := s.stateFuncs
+
+	s.Unlock()
+
+	zerolog.Ctx(ctx).Info().Str("state", string(state)).Msg("Serial connection state changed")
+
+	for _, f := range funcs {
+		f(ctx, state)
+	}
+}
+
+func (s *Serial) run(ctx context.Context, hotplug <-chan struct{}) {
 	logger := zerolog.Ctx(ctx)
 
+	// the port might have been reopened after ctx was done.
+	defer s.close(logger.With().Logger())
+
+	delay := minReconnectDelay
+
 	for {
-		err := s.scanLines()
+		err := s.open(ctx)
 		if err != nil {
-			s.Errors <- errorx.Decorate(err, "scan lines")
-		}
+			logger.Debug().Err(err).Dur("retry_in", delay).Msg("failed to open serial port")
 
-		err = s.f.Close()
-		if err != nil {
-			logger.Error().Err(err).Msg("failed to close serial port")
-		}
+			s.setState(ctx, StateDisconnected)
 
-		reconnected := false
+			if !waitReconnect(ctx, delay, hotplug) {
+				return
+			}
 
-		// try to reconnect.
-		for attempt := range reconnectAttempts {
-			logger.Debug().Int("attempt", attempt).Msg("reconnecting to serial port")
+			delay = min(delay*2, maxReconnectDelay)
 
-			err = s.open()
-			if err == nil {
-				reconnected = true
+			continue
+		}
 
-				break
-			}
+		connected := time.Now()
+
+		s.setState(ctx, StateConnected)
+
+		err = s.scanLines(ctx)
 
-			logger.Error().Err(err).Msg("failed to reopen serial port")
+		if ctx.Err() != nil {
+			return
+		}
 
-			time.Sleep(reconnectDelay)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to scan lines")
 		}
 
-		if !reconnected {
-			s.Errors <- errorx.IllegalState.New("failed to reconnect to serial port after %d attempts", reconnectAttempts)
+		s.close(logger.With().Logger())
+
+		s.setState(ctx, StateDisconnected)
 
+		// reopening resets most boards, so a connection that keeps dropping is retried with backoff as well.
+		if time.Since(connected) >= maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+
+		if !waitReconnect(ctx, delay, hotplug) {
 			return
 		}
+
+		delay = min(delay*2, maxReconnectDelay)
 	}
 }
 
-func (s *Serial) scanLines() error {
-	scanner := bufio.NewScanner(s.f)
+// waitReconnect waits for delay or a hotplug event, returns false if ctx is done first.
+func waitReconnect(ctx context.Context, delay time.Duration, hotplug <-chan struct{}) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	case <-hotplug:
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(hotplugSettleDelay):
+		return true
+	}
+}
+
+func (s *Serial) scanLines(ctx context.Context) error {
+	s.Lock()
+
+	f := s.f
+
+	s.Unlock()
+
+	if f == nil {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(idleReader{ctx: ctx, r: f})
 
 	for scanner.Scan() {
-		s.Lines <- scanner.Bytes()
+		select {
+		case <-ctx.Done():
+			return nil
+		// the scanner reuses its buffer on the next scan, while the line may still be parsed.
+		case s.Lines <- bytes.Clone(scanner.Bytes()):
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -121,3 +279,26 @@ func (s *Serial) scanLines() error {
 
 	return nil
 }
+
+// idleReader keeps reading through read timeouts of the port, which tarm/serial reports as io.EOF,
+// so that boards that only send on change are not taken for disconnected.
+type idleReader struct {
+	ctx context.Context //nolint:containedctx // bounds a single scan.
+	r   io.Reader
+}
+
+func (r idleReader) Read(b []byte) (int, error) {
+	for {
+		start := time.Now()
+
+		n, err := r.r.Read(b)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err //nolint:wrapcheck // decorated by the scanner.
+		}
+
+		// a hung up tty returns right away instead of after the timeout.
+		if r.ctx.Err() != nil || time.Since(start) < readTimeout/2 {
+			return 0, io.EOF
+		}
+	}
+}
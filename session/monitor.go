@@ -1,7 +1,10 @@
 package session
 
 import (
+	"cmp"
 	"context"
+	"reflect"
+	"slices"
 	"sync"
 
 	"github.com/joomcode/errorx"
@@ -12,23 +15,48 @@ import (
 type Monitor struct {
 	sync.RWMutex `exhaustruct:"optional"`
 
-	events chan pipewire.Event
-	Nodes  map[string]map[int]*pipewire.Node
+	client   *pipewire.Client
+	registry *pipewire.Registry
+	// Nodes holds output streams by binary.
+	Nodes map[string]map[int]*pipewire.Node
+	// Inputs holds capture streams by binary.
+	Inputs map[string]map[int]*pipewire.Node
+	// Master is the default sink, nil if there is none.
+	Master *pipewire.Node
+	// Mic is the default source, nil if there is none.
+	Mic *pipewire.Node
+
+	sinks   map[int]*pipewire.Node
+	sources map[int]*pipewire.Node
+	volumes map[int]pipewire.Volume
+	// ancestries holds the processes of streams by node id, resolved once per process.
+	ancestries map[int][]Process
 
 	updateFuncs []func(context.Context)
+	volumeFuncs []func(context.Context)
 }
 
 func NewMonitor(ctx context.Context) (*Monitor, error) {
-	events, err := pipewire.MonitorOutputs(ctx)
+	registry, err := pipewire.MonitorRegistry(ctx)
 	if err != nil {
-		return nil, errorx.Decorate(err, "monitor outputs")
+		return nil, errorx.Decorate(err, "monitor registry")
 	}
 
 	m := &Monitor{
-		events: events,
-		Nodes:  make(map[string]map[int]*pipewire.Node),
+		client:   pipewire.NewClient(),
+		registry: registry,
+		Nodes:    make(map[string]map[int]*pipewire.Node),
+		Inputs:   make(map[string]map[int]*pipewire.Node),
+		Master:   nil,
+		Mic:      nil,
+
+		sinks:      make(map[int]*pipewire.Node),
+		sources:    make(map[int]*pipewire.Node),
+		volumes:    make(map[int]pipewire.Volume),
+		ancestries: make(map[int][]Process),
 
 		updateFuncs: make([]func(context.Context), 0),
+		volumeFuncs: make([]func(context.Context), 0),
 	}
 
 	go m.handleEvents(ctx)
@@ -43,6 +71,27 @@ func (m *Monitor) OnUpdate(f func(context.Context)) {
 	m.updateFuncs = append(m.updateFuncs, f)
 }
 
+// OnVolume registers f to be called whenever the volume or mute state of a node changes.
+func (m *Monitor) OnVolume(f func(context.Context)) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.volumeFuncs = append(m.volumeFuncs, f)
+}
+
+// Volume returns the last seen volume of the node with the given id, it has to be called with the lock held.
+func (m *Monitor) Volume(id int) (pipewire.Volume, bool) {
+	volume, ok := m.volumes[id]
+
+	return volume, ok
+}
+
+// Ancestry returns the process of the stream with the given id followed by its ancestors,
+// empty if the stream does not report its process or it exited. It has to be called with the lock held.
+func (m *Monitor) Ancestry(id int) []Process {
+	return m.ancestries[id]
+}
+
 func (m *Monitor) handleEvents(ctx context.Context) {
 	logger := zerolog.Ctx(ctx)
 
@@ -50,39 +99,33 @@ func (m *Monitor) handleEvents(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case event := <-m.events:
-			logger.Debug().Str("action", string(event.Action)).Int("port", event.Port.ID).Msg("got event")
-
-			switch event.Action {
-			case pipewire.ActionRemove:
-				m.Lock()
+		case event := <-m.registry.Events:
+			m.Lock()
 
-				deletePortNode(m.Nodes, event.Port)
+			changed := m.handleEvent(event)
+			volumeChanged := m.updateVolume(event)
 
-				m.Unlock()
-			case pipewire.ActionAdd:
-				node, err := pipewire.GetPortNode(ctx, event.Port.ID)
-				if err != nil {
-					// this is not important, it just means that the update was not related to a port at all.
-					logger.Debug().Err(err).Msg("failed to get port node")
+			m.Unlock()
 
-					continue
+			if volumeChanged {
+				for _, f := range m.volumeFuncs {
+					f(ctx)
 				}
+			}
 
-				m.Lock()
-
-				if _, ok := m.Nodes[node.Binary]; !ok {
-					m.Nodes[node.Binary] = make(map[int]*pipewire.Node, 1)
-				}
-
-				m.Nodes[node.Binary][node.ID] = node
-
-				m.Unlock()
+			// most changes are volume updates, which do not affect the mapping.
+			if !changed {
+				continue
 			}
 
+			logger.Debug().Str("action", string(event.Action)).Int("id", event.Object.ID).Msg("got event")
+
 			m.RLock()
 
-			logger.Debug().Any("nodes", m.Nodes).Msg("current nodes")
+			logger.Debug().
+				Any("nodes", m.Nodes).Any("inputs", m.Inputs).
+				Any("master", m.Master).Any("mic", m.Mic).Any("sinks", m.sinks).Any("sources", m.sources).
+				Msg("current nodes")
 
 			m.RUnlock()
 
@@ -93,16 +136,213 @@ func (m *Monitor) handleEvents(ctx context.Context) {
 	}
 }
 
-func deletePortNode(nodes map[string]map[int]*pipewire.Node, port pipewire.Port) {
+// handleEvent has to be called with the lock held.
+func (m *Monitor) handleEvent(event pipewire.Event) bool {
+	switch event.Object.Type {
+	case pipewire.TypeNode:
+	case pipewire.TypeMetadata:
+		return m.refreshDefaults()
+	default:
+		return false
+	}
+
+	id := event.Object.ID
+
+	var changed bool
+
+	switch event.Action {
+	case pipewire.ActionRemove:
+		changed = deleteNode(m.Nodes, id)
+		changed = deleteNode(m.Inputs, id) || changed
+
+		delete(m.ancestries, id)
+
+		_, isSink := m.sinks[id]
+		_, isSource := m.sources[id]
+
+		if isSink || isSource {
+			delete(m.sinks, id)
+			delete(m.sources, id)
+
+			changed = true
+		}
+	case pipewire.ActionAdd, pipewire.ActionChange:
+		class := event.Object.Props().String("media.class")
+		node := pipewire.NewNode(m.client, event.Object)
+
+		changed = putNode(m.Nodes, node, class == pipewire.MediaClassOutput)
+		changed = putNode(m.Inputs, node, class == pipewire.MediaClassInput) || changed
+
+		m.updateAncestry(node, class == pipewire.MediaClassOutput || class == pipewire.MediaClassInput)
+
+		changed = putDevice(m.sinks, node, class == pipewire.MediaClassSink) || changed
+		changed = putDevice(m.sources, node, class == pipewire.MediaClassSource) || changed
+	}
+
+	return m.refreshDefaults() || changed
+}
+
+// Sinks returns all sinks ordered by id, it has to be called with the lock held.
+func (m *Monitor) Sinks() []*pipewire.Node {
+	return sortedNodes(m.sinks)
+}
+
+// Sources returns all sources ordered by id, it has to be called with the lock held.
+func (m *Monitor) Sources() []*pipewire.Node {
+	return sortedNodes(m.sources)
+}
+
+func sortedNodes(nodesm map[int]*pipewire.Node) []*pipewire.Node {
+	nodes := make([]*pipewire.Node, 0, len(nodesm))
+
+	for _, node := range nodesm {
+		nodes = append(nodes, node)
+	}
+
+	slices.SortFunc(nodes, func(a, b *pipewire.Node) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return nodes
+}
+
+// updateVolume has to be called with the lock held. Returns whether the volume of a node changed.
+func (m *Monitor) updateVolume(event pipewire.Event) bool {
+	if event.Object.Type != pipewire.TypeNode {
+		return false
+	}
+
+	id := event.Object.ID
+	old, existed := m.volumes[id]
+
+	volume, ok := event.Object.Volume()
+	if !ok || event.Action == pipewire.ActionRemove {
+		delete(m.volumes, id)
+
+		return existed
+	}
+
+	m.volumes[id] = volume
+
+	return !existed || old != volume
+}
+
+// updateAncestry resolves the processes of stream nodes, it has to be called with the lock held.
+// They are only resolved again if the node reports another process, so that its ancestry stays the same
+// when parents exit and the process is reparented.
+func (m *Monitor) updateAncestry(node *pipewire.Node, stream bool) {
+	pid, ok := node.Props.Int("application.process.id")
+	if !stream || !ok {
+		delete(m.ancestries, node.ID)
+
+		return
+	}
+
+	if old := m.ancestries[node.ID]; len(old) > 0 && old[0].PID == pid {
+		return
+	}
+
+	m.ancestries[node.ID] = resolveAncestry(pid)
+}
+
+// refreshDefaults has to be called with the lock held.
+func (m *Monitor) refreshDefaults() bool {
+	master := m.defaultNode(m.sinks, pipewire.KeyDefaultSink)
+	mic := m.defaultNode(m.sources, pipewire.KeyDefaultSource)
+
+	changed := !sameNode(master, m.Master) || !sameNode(mic, m.Mic)
+
+	m.Master = master
+	m.Mic = mic
+
+	return changed
+}
+
+func (m *Monitor) defaultNode(devices map[int]*pipewire.Node, key string) *pipewire.Node {
+	name := m.registry.DefaultNodeName(key)
+
+	for _, device := range devices {
+		if device.Name == name {
+			return device
+		}
+	}
+
+	return nil
+}
+
+func sameNode(a, b *pipewire.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.ID == b.ID
+}
+
+// putNode adds node to nodes keyed by binary if it belongs there, or removes it otherwise.
+// Returns whether nodes was changed.
+func putNode(nodes map[string]map[int]*pipewire.Node, node *pipewire.Node, belongs bool) bool {
+	if !belongs {
+		return deleteNode(nodes, node.ID)
+	}
+
+	if old, ok := nodes[node.Binary][node.ID]; ok {
+		// targets may select on any property, i.e. media.name changing with the track played,
+		// and channels are only known once the params of the node are.
+		if sameProps(old, node) {
+			return false
+		}
+
+		nodes[node.Binary][node.ID] = node
+
+		return true
+	}
+
+	// the binary might have changed, drop the node from its old key.
+	deleteNode(nodes, node.ID)
+
+	if _, ok := nodes[node.Binary]; !ok {
+		nodes[node.Binary] = make(map[int]*pipewire.Node, 1)
+	}
+
+	nodes[node.Binary][node.ID] = node
+
+	return true
+}
+
+// putDevice adds node to devices if it belongs there, or removes it otherwise.
+// Returns whether the node was added, removed or its properties changed.
+func putDevice(devices map[int]*pipewire.Node, node *pipewire.Node, belongs bool) bool {
+	old, ok := devices[node.ID]
+
+	if !belongs {
+		delete(devices, node.ID)
+
+		return ok
+	}
+
+	devices[node.ID] = node
+
+	return !ok || !sameProps(old, node)
+}
+
+func sameProps(a, b *pipewire.Node) bool {
+	return a.Channels == b.Channels && reflect.DeepEqual(a.Props, b.Props)
+}
+
+func deleteNode(nodes map[string]map[int]*pipewire.Node, id int) bool {
+	deleted := false
+
 	for key, nodesm := range nodes {
-		for nodeID, node := range nodesm {
-			if node.PortID == port.ID {
-				delete(nodes[node.Binary], nodeID)
-			}
+		if _, ok := nodesm[id]; ok {
+			delete(nodesm, id)
+
+			deleted = true
 		}
 
 		if len(nodesm) == 0 {
 			delete(nodes, key)
 		}
 	}
+
+	return deleted
 }
@@ -0,0 +1,67 @@
+package session
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// maxAncestry bounds walks up the process tree, in case /proc changes under them.
+const maxAncestry = 64
+
+// Process is a process in the ancestry of a stream.
+type Process struct {
+	PID int
+	// Name is the command name, which the kernel truncates to 15 characters.
+	Name string
+}
+
+// resolveAncestry returns the process pid followed by its ancestors up to, but excluding, init.
+// It stops early at processes it cannot read, i.e. those that exited already.
+func resolveAncestry(pid int) []Process {
+	ancestry := make([]Process, 0)
+
+	for range maxAncestry {
+		if pid <= 1 {
+			break
+		}
+
+		name, ppid, ok := readStat(pid)
+		if !ok {
+			break
+		}
+
+		ancestry = append(ancestry, Process{PID: pid, Name: name})
+		pid = ppid
+	}
+
+	return ancestry
+}
+
+// readStat reads the command name and parent of pid from /proc/<pid>/stat.
+func readStat(pid int) (string, int, bool) {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", 0, false
+	}
+
+	// the command name is in parentheses and may contain anything, the state and parent follow the last one.
+	start := bytes.IndexByte(stat, '(')
+	end := bytes.LastIndexByte(stat, ')')
+
+	if start < 0 || end < start {
+		return "", 0, false
+	}
+
+	fields := bytes.Fields(stat[end+1:])
+	if len(fields) < 2 { //nolint:mnd // state and parent.
+		return "", 0, false
+	}
+
+	ppid, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return "", 0, false
+	}
+
+	return string(stat[start+1 : end]), ppid, true
+}
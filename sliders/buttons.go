@@ -0,0 +1,160 @@
+package sliders
+
+import (
+	"context"
+	"slices"
+
+	"github.com/omriharel/deej/config"
+	"github.com/omriharel/deej/pipewire"
+	"github.com/rs/zerolog"
+)
+
+// HandleButton runs the action mapped to the button with index idx when it is pressed.
+func (s *Sliders) HandleButton(ctx context.Context, idx int, pressed bool) {
+	logger := zerolog.Ctx(ctx)
+
+	if !pressed {
+		return
+	}
+
+	s.RLock()
+
+	button, ok := s.buttons[idx]
+
+	s.RUnlock()
+
+	if !ok {
+		logger.Debug().Int("idx", idx).Msg("Button is not mapped")
+
+		return
+	}
+
+	logger.Debug().Int("idx", idx).Str("action", button.Action).Msg("Button pressed")
+
+	go s.runAction(ctx, button)
+}
+
+func (s *Sliders) runAction(ctx context.Context, button config.ButtonConfig) {
+	switch button.Action {
+	case config.ActionMuteSlider:
+		s.RLock()
+
+		var slider *Slider
+
+		if *button.Slider < len(s.sliders) {
+			slider = s.sliders[*button.Slider]
+		}
+
+		s.RUnlock()
+
+		if slider == nil {
+			return
+		}
+
+		slider.RLock()
+
+		targets := slider.targets
+
+		slider.RUnlock()
+
+		s.toggleTargetsMute(ctx, targets)
+	case config.ActionMuteMic:
+		s.sm.RLock()
+		defer s.sm.RUnlock()
+
+		s.toggleMute(ctx, deviceNodes(s.sm.Mic))
+	case config.ActionToggleDefaultSink:
+		s.toggleDefaultSink(ctx, button.Sinks)
+	}
+}
+
+// toggleTargetsMute toggles mute on all nodes of targets.
+func (s *Sliders) toggleTargetsMute(ctx context.Context, targets []config.Target) {
+	sel := s.selection()
+
+	s.sm.RLock()
+	defer s.sm.RUnlock()
+
+	nodes := make([]*pipewire.Node, 0)
+
+	for _, target := range targets {
+		nodes = append(nodes, s.targetNodes(sel, target)...)
+	}
+
+	s.toggleMute(ctx, nodes)
+}
+
+// toggleMute mutes nodes, or unmutes them if all of them are muted already.
+// It has to be called with the session monitor lock held.
+func (s *Sliders) toggleMute(ctx context.Context, nodes []*pipewire.Node) {
+	logger := zerolog.Ctx(ctx)
+
+	mute := slices.ContainsFunc(nodes, func(node *pipewire.Node) bool {
+		volume, ok := s.sm.Volume(node.ID)
+
+		return !ok || !volume.Muted
+	})
+
+	for _, node := range nodes {
+		err := node.SetMute(ctx, mute)
+		if err != nil {
+			logger.Error().Err(err).Str("binary", node.Binary).Str("name", node.Name).Msg("Failed to set mute")
+		}
+	}
+}
+
+// toggleDefaultSink makes the sink after the current default one among names the default,
+// or among all sinks if names is empty.
+func (s *Sliders) toggleDefaultSink(ctx context.Context, names []string) {
+	logger := zerolog.Ctx(ctx)
+
+	s.sm.RLock()
+
+	sinks := s.sm.Sinks()
+	master := s.sm.Master
+
+	s.sm.RUnlock()
+
+	if len(names) > 0 {
+		sinks = selectSinks(sinks, names)
+	}
+
+	if len(sinks) == 0 {
+		logger.Warn().Strs("sinks", names).Msg("No sinks to switch to")
+
+		return
+	}
+
+	// start at the first sink if the default one is not among them.
+	next := sinks[0]
+
+	if master != nil {
+		if i := slices.IndexFunc(sinks, func(sink *pipewire.Node) bool { return sink.ID == master.ID }); i >= 0 {
+			next = sinks[(i+1)%len(sinks)]
+		}
+	}
+
+	err := pipewire.SetDefaultNode(ctx, pipewire.KeyConfiguredSink, next.Name)
+	if err != nil {
+		logger.Error().Err(err).Str("name", next.Name).Msg("Failed to set default sink")
+
+		return
+	}
+
+	logger.Info().Str("name", next.Name).Str("description", next.Description).Msg("Default sink changed")
+}
+
+// selectSinks returns sinks matching names by node name or description, in the order of names.
+func selectSinks(sinks []*pipewire.Node, names []string) []*pipewire.Node {
+	selected := make([]*pipewire.Node, 0, len(names))
+
+	for _, name := range names {
+		for _, sink := range sinks {
+			if (sink.Name == name || sink.Description == name) && !slices.Contains(selected, sink) {
+				selected = append(selected, sink)
+			}
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,83 @@
+package sliders
+
+import (
+	"math"
+
+	"github.com/omriharel/deej/config"
+)
+
+const (
+	// precision of inverting curves by bisection, well below a step of a 12 bit ADC.
+	curveInverseIterations = 20
+	// amplitude decibels per factor of ten.
+	decibelsPerDecade = 20
+)
+
+// curve maps a slider position in [0, 1] to a volume in [0, 1], it has to be non-decreasing.
+type curve func(x float64) float64
+
+func newCurve(cfg config.Curve) curve {
+	switch cfg.Curve {
+	case config.CurveCubic:
+		// pipewire volumes are linear, mixers show their cubic root.
+		return func(x float64) float64 {
+			return x * x * x
+		}
+	case config.CurveLog:
+		return func(x float64) float64 {
+			if x <= 0 {
+				return 0
+			}
+
+			return math.Pow(10, (x-1)*cfg.DB/decibelsPerDecade)
+		}
+	case config.CurveCustom:
+		return pointsCurve(cfg.Points)
+	default:
+		return func(x float64) float64 {
+			return x
+		}
+	}
+}
+
+// pointsCurve interpolates linearly between points, which are validated by config.
+func pointsCurve(points [][]float64) curve {
+	return func(x float64) float64 {
+		if x <= points[0][0] {
+			return points[0][1]
+		}
+
+		for i := 1; i < len(points); i++ {
+			x0, y0 := points[i-1][0], points[i-1][1]
+			x1, y1 := points[i][0], points[i][1]
+
+			if x <= x1 {
+				return y0 + (y1-y0)*(x-x0)/(x1-x0)
+			}
+		}
+
+		return points[len(points)-1][1]
+	}
+}
+
+// inverse returns the lowest slider position reaching volume y.
+func (c curve) inverse(y float64) float64 {
+	// bisection never reaches the bottom, which has to stay at the volume of the curve there, i.e. silence.
+	if y <= c(0) {
+		return 0
+	}
+
+	lo, hi := 0.0, 1.0
+
+	for range curveInverseIterations {
+		mid := (lo + hi) / 2
+
+		if c(mid) < y {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return hi
+}
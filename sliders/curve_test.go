@@ -0,0 +1,91 @@
+package sliders
+
+import (
+	"math"
+	"testing"
+
+	"github.com/omriharel/deej/config"
+)
+
+const volumeTolerance = 1e-4
+
+//nolint:gochecknoglobals // shared with the limits tests.
+var testCurves = map[string]config.Curve{
+	config.CurveLinear: {Curve: config.CurveLinear, DB: 0, Points: nil},
+	config.CurveCubic:  {Curve: config.CurveCubic, DB: 0, Points: nil},
+	config.CurveLog:    {Curve: config.CurveLog, DB: 60, Points: nil},
+	config.CurveCustom: {Curve: config.CurveCustom, DB: 0, Points: [][]float64{{0, 0}, {0.5, 0.2}, {1, 1}}},
+}
+
+func TestNewCurve(t *testing.T) {
+	tests := []struct {
+		curve string
+		// volumes at positions 0, 0.5 and 1.
+		volumes [3]float64
+	}{
+		{curve: config.CurveLinear, volumes: [3]float64{0, 0.5, 1}},
+		{curve: config.CurveCubic, volumes: [3]float64{0, 0.125, 1}},
+		// -30 dB at the middle of a 60 dB range, the bottom is muted.
+		{curve: config.CurveLog, volumes: [3]float64{0, math.Pow(10, -1.5), 1}},
+		{curve: config.CurveCustom, volumes: [3]float64{0, 0.2, 1}},
+	}
+
+	for _, test := range tests {
+		c := newCurve(testCurves[test.curve])
+
+		for i, x := range []float64{0, 0.5, 1} {
+			if v := c(x); math.Abs(v-test.volumes[i]) > 1e-9 {
+				t.Errorf("%s curve at %g: expected %g, got %g", test.curve, x, test.volumes[i], v)
+			}
+		}
+	}
+}
+
+func TestPointsCurve(t *testing.T) {
+	c := pointsCurve([][]float64{{0.1, 0.05}, {0.5, 0.25}, {0.9, 1}})
+
+	tests := []struct {
+		x, y float64
+	}{
+		// flat before the first and after the last point.
+		{x: 0, y: 0.05},
+		{x: 0.1, y: 0.05},
+		{x: 0.3, y: 0.15},
+		{x: 0.5, y: 0.25},
+		{x: 0.7, y: 0.625},
+		{x: 0.9, y: 1},
+		{x: 1, y: 1},
+	}
+
+	for _, test := range tests {
+		if y := c(test.x); math.Abs(y-test.y) > 1e-9 {
+			t.Errorf("at %g: expected %g, got %g", test.x, test.y, y)
+		}
+	}
+}
+
+func TestCurveInverse(t *testing.T) {
+	for name, cfg := range testCurves {
+		c := newCurve(cfg)
+
+		// the bottom has to be reached exactly, bisection alone stops just above it.
+		if x := c.inverse(0); x != 0 {
+			t.Errorf("%s: expected volume 0 at position 0, got %g", name, x)
+		}
+
+		if x := c.inverse(1); math.Abs(x-1) > volumeTolerance {
+			t.Errorf("%s: expected volume 1 at position 1, got %g", name, x)
+		}
+
+		for _, x := range []float64{0.2, 0.5, 0.8} {
+			if back := c.inverse(c(x)); math.Abs(back-x) > volumeTolerance {
+				t.Errorf("%s: expected inverse to undo the curve at %g, got %g", name, x, back)
+			}
+		}
+	}
+
+	// positions below the first point of a custom curve all reach its volume, the lowest one is returned.
+	if x := pointsCurve([][]float64{{0.2, 0.1}, {1, 1}}).inverse(0.1); x != 0 {
+		t.Errorf("expected the bottom for the volume of the first point, got %g", x)
+	}
+}
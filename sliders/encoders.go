@@ -0,0 +1,176 @@
+package sliders
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/omriharel/deej/config"
+	"github.com/omriharel/deej/pipewire"
+	"github.com/rs/zerolog"
+)
+
+// detents turned within this long after the previous ones are accelerated.
+const accelerationWindow = 150 * time.Millisecond
+
+// Encoder changes the volume of its targets relative to their current one.
+type Encoder struct {
+	sync.Mutex `exhaustruct:"optional"`
+
+	targets      []config.Target
+	step         float32
+	acceleration float32
+	pushToMute   bool
+
+	lastTurn time.Time
+	// volumes written on the last turn by node id, used instead of the reported ones for readbackDelay.
+	written map[int]float32
+
+	// volumes the worker has yet to write by node id, only the latest one of each node is written.
+	pending map[int]nodeVolume
+	// signals the worker that volumes are pending, pending signals are coalesced.
+	changed chan struct{}
+	stop    context.CancelFunc
+}
+
+type nodeVolume struct {
+	node   *pipewire.Node
+	volume float32
+}
+
+// newEncoder creates an encoder whose worker runs until it is replaced or ctx is done.
+func newEncoder(ctx context.Context, ec config.EncoderConfig) *Encoder {
+	ctx, cancel := context.WithCancel(ctx)
+
+	encoder := &Encoder{
+		targets:      parseTargets(ctx, ec.Targets),
+		step:         float32(ec.Step),
+		acceleration: float32(ec.Acceleration),
+		pushToMute:   ec.PushToMute,
+
+		lastTurn: time.Time{},
+		written:  make(map[int]float32),
+
+		pending: make(map[int]nodeVolume),
+		changed: make(chan struct{}, 1),
+		stop:    cancel,
+	}
+
+	go encoder.run(ctx)
+
+	return encoder
+}
+
+// run writes pending volumes one after another, so that a fast turn ends at the volume of its last detent.
+func (e *Encoder) run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.changed:
+		}
+
+		e.Lock()
+
+		pending := e.pending
+		e.pending = make(map[int]nodeVolume, len(pending))
+
+		e.Unlock()
+
+		for _, nv := range pending {
+			err := nv.node.SetVolume(ctx, nv.volume)
+			if err != nil {
+				logger.Error().Err(err).Str("binary", nv.node.Binary).Str("name", nv.node.Name).Msg("Failed to set volume")
+			}
+		}
+	}
+}
+
+// HandleEncoder changes the volume of the targets of the encoder with index idx by steps detents.
+func (s *Sliders) HandleEncoder(ctx context.Context, idx, steps int) {
+	logger := zerolog.Ctx(ctx)
+
+	s.RLock()
+
+	encoder, ok := s.encoders[idx]
+
+	s.RUnlock()
+
+	if !ok {
+		logger.Debug().Int("idx", idx).Msg("Encoder is not mapped")
+
+		return
+	}
+
+	encoder.Lock()
+	defer encoder.Unlock()
+
+	now := time.Now()
+	since := now.Sub(encoder.lastTurn)
+
+	delta := float32(steps) * encoder.step
+	if since < accelerationWindow {
+		delta *= encoder.acceleration
+	}
+
+	if since >= readbackDelay {
+		clear(encoder.written)
+	}
+
+	encoder.lastTurn = now
+
+	sel := s.selection()
+
+	s.sm.RLock()
+
+	for _, target := range encoder.targets {
+		for _, node := range s.targetNodes(sel, target) {
+			current, ok := encoder.written[node.ID]
+			if !ok {
+				volume, ok := s.sm.Volume(node.ID)
+				if !ok {
+					continue
+				}
+
+				// what the node plays at, including channel volumes set in mixers.
+				current = volume.Effective()
+			}
+
+			// volumes boosted above 100% in mixers are turned down from there rather than cut to 100%.
+			encoder.written[node.ID] = min(max(current+delta, 0), max(current, 1))
+			encoder.pending[node.ID] = nodeVolume{node: node, volume: encoder.written[node.ID]}
+		}
+	}
+
+	s.sm.RUnlock()
+
+	logger.Debug().Int("idx", idx).Int("steps", steps).Float32("delta", delta).Msg("Encoder turned")
+
+	select {
+	case encoder.changed <- struct{}{}:
+	default:
+	}
+}
+
+// HandlePush toggles mute on the targets of the encoder with index idx when it is pushed, if it has push_to_mute set.
+func (s *Sliders) HandlePush(ctx context.Context, idx int, pressed bool) {
+	if !pressed {
+		return
+	}
+
+	s.RLock()
+
+	encoder, ok := s.encoders[idx]
+
+	s.RUnlock()
+
+	if !ok || !encoder.pushToMute {
+		return
+	}
+
+	zerolog.Ctx(ctx).Debug().Int("idx", idx).Msg("Encoder pushed")
+
+	go s.toggleTargetsMute(ctx, encoder.targets)
+}
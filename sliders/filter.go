@@ -0,0 +1,55 @@
+package sliders
+
+import (
+	"slices"
+
+	"github.com/omriharel/deej/config"
+)
+
+// filter smooths readings of a slider, keeping its state between calls.
+type filter func(x float32) float32
+
+func newFilter(cfg config.Filter) filter {
+	switch cfg.Filter {
+	case config.FilterEMA:
+		return emaFilter(float32(cfg.Alpha))
+	case config.FilterMedian:
+		return medianFilter(cfg.Window)
+	default:
+		return func(x float32) float32 {
+			return x
+		}
+	}
+}
+
+func emaFilter(alpha float32) filter {
+	avg := float32(-1)
+
+	return func(x float32) float32 {
+		if avg < 0 {
+			avg = x
+		} else {
+			avg += alpha * (x - avg)
+		}
+
+		return avg
+	}
+}
+
+func medianFilter(window int) filter {
+	readings := make([]float32, 0, window)
+	sorted := make([]float32, 0, window)
+
+	return func(x float32) float32 {
+		if len(readings) == window {
+			readings = readings[1:]
+		}
+
+		readings = append(readings, x)
+
+		sorted = append(sorted[:0], readings...)
+		slices.Sort(sorted)
+
+		return sorted[len(sorted)/2]
+	}
+}
@@ -0,0 +1,42 @@
+package sliders
+
+import (
+	"github.com/omriharel/deej/config"
+)
+
+// limits shape slider positions before they are turned into volumes,
+// snapping the dead zones to the ends and spreading the rest between the minimum and maximum.
+type limits struct {
+	deadZoneLow  float64
+	deadZoneHigh float64
+	// positions reaching the minimum and maximum volume through the curve.
+	minPosition float64
+	maxPosition float64
+}
+
+func newLimits(sc config.SliderConfig, c curve) limits {
+	return limits{
+		deadZoneLow:  sc.DeadZoneLow,
+		deadZoneHigh: sc.DeadZoneHigh,
+		minPosition:  c.inverse(sc.MinVolume),
+		maxPosition:  c.inverse(*sc.MaxVolume),
+	}
+}
+
+func (l limits) apply(x float64) float64 {
+	x = (x - l.deadZoneLow) / (1 - l.deadZoneLow - l.deadZoneHigh)
+	x = min(max(x, 0), 1)
+
+	return l.minPosition + x*(l.maxPosition-l.minPosition)
+}
+
+// unapply returns the raw position the shaped position x is read at, the inner end of the dead zones for the ends.
+func (l limits) unapply(x float64) float64 {
+	if l.maxPosition > l.minPosition {
+		x = (x - l.minPosition) / (l.maxPosition - l.minPosition)
+	}
+
+	x = min(max(x, 0), 1)
+
+	return l.deadZoneLow + x*(1-l.deadZoneLow-l.deadZoneHigh)
+}
@@ -0,0 +1,69 @@
+package sliders
+
+import (
+	"math"
+	"testing"
+
+	"github.com/omriharel/deej/config"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name                      string
+		minVolume, maxVolume      float64
+		deadZoneLow, deadZoneHigh float64
+	}{
+		{name: "default", minVolume: 0, maxVolume: 1, deadZoneLow: 0, deadZoneHigh: 0},
+		{name: "dead zones", minVolume: 0, maxVolume: 1, deadZoneLow: 0.05, deadZoneHigh: 0.1},
+		{name: "volume range", minVolume: 0.1, maxVolume: 0.8, deadZoneLow: 0, deadZoneHigh: 0},
+		{name: "all", minVolume: 0.2, maxVolume: 0.5, deadZoneLow: 0.1, deadZoneHigh: 0.05},
+	}
+
+	for name, cfg := range testCurves {
+		for _, test := range tests {
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+				c := newCurve(cfg)
+				l := newLimits(config.SliderConfig{
+					MinVolume:    test.minVolume,
+					MaxVolume:    &test.maxVolume,
+					DeadZoneLow:  test.deadZoneLow,
+					DeadZoneHigh: test.deadZoneHigh,
+				}, c)
+
+				// the bottom is silent unless a minimum is set, whatever the curve.
+				if bottom := c(l.apply(0)); test.minVolume == 0 && bottom != 0 {
+					t.Errorf("expected the bottom at exactly 0, got %g", bottom)
+				} else if math.Abs(bottom-test.minVolume) > volumeTolerance {
+					t.Errorf("expected the bottom at %g, got %g", test.minVolume, bottom)
+				}
+
+				if top := c(l.apply(1)); math.Abs(top-test.maxVolume) > volumeTolerance {
+					t.Errorf("expected the top at %g, got %g", test.maxVolume, top)
+				}
+
+				if l.apply(test.deadZoneLow/2) != l.apply(0) {
+					t.Errorf("expected the low dead zone to snap to the bottom")
+				}
+
+				if l.apply(1-test.deadZoneHigh/2) != l.apply(1) {
+					t.Errorf("expected the high dead zone to snap to the top")
+				}
+
+				for _, x := range []float64{0.25, 0.5, 0.75} {
+					if back := l.unapply(l.apply(x)); math.Abs(back-x) > volumeTolerance {
+						t.Errorf("expected unapply to undo apply at %g, got %g", x, back)
+					}
+				}
+
+				// the ends report the inner end of the dead zones.
+				if back := l.unapply(l.apply(0)); math.Abs(back-test.deadZoneLow) > volumeTolerance {
+					t.Errorf("expected the bottom to be reported at %g, got %g", test.deadZoneLow, back)
+				}
+
+				if back := l.unapply(l.apply(1)); math.Abs(back-(1-test.deadZoneHigh)) > volumeTolerance {
+					t.Errorf("expected the top to be reported at %g, got %g", 1-test.deadZoneHigh, back)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package sliders
+
+import (
+	"context"
+	"slices"
+
+	"github.com/omriharel/deej/config"
+	"github.com/omriharel/deej/pipewire"
+	"github.com/omriharel/deej/session"
+	"github.com/rs/zerolog"
+)
+
+// matchStream reports whether the stream node matches p, given its processes as resolved by the session monitor.
+func matchStream(p *config.Pattern, node *pipewire.Node, ancestry []session.Process) bool {
+	if p.Property != "" {
+		return p.Match(node.Props.String(p.Property))
+	}
+
+	if p.Match(node.Binary) {
+		return true
+	}
+
+	return p.Tree && slices.ContainsFunc(ancestry, func(proc session.Process) bool {
+		return p.Match(proc.Name)
+	})
+}
+
+// matchDevice reports whether the sink or source node matches p.
+func matchDevice(p *config.Pattern, node *pipewire.Node) bool {
+	if p.Property != "" {
+		return p.Match(node.Props.String(p.Property))
+	}
+
+	return p.Match(node.Name) || (node.Description != "" && p.Match(node.Description))
+}
+
+// parseTargets parses non-empty targets, logging and skipping invalid ones, which config validation rejects already.
+func parseTargets(ctx context.Context, raws []string) []config.Target {
+	targets := make([]config.Target, 0, len(raws))
+
+	for _, raw := range raws {
+		if raw == "" {
+			continue
+		}
+
+		t, err := config.ParseTarget(raw)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("target", raw).Msg("Ignoring invalid target")
+
+			continue
+		}
+
+		targets = append(targets, t)
+	}
+
+	return targets
+}
+
+func targetNames(targets []config.Target) []string {
+	names := make([]string, len(targets))
+
+	for i, t := range targets {
+		names[i] = t.Raw
+	}
+
+	return names
+}
+
+// matchesStream reports whether any of targets selects the output stream node by a pattern.
+func matchesStream(targets []config.Target, node *pipewire.Node, ancestry []session.Process) bool {
+	return slices.ContainsFunc(targets, func(t config.Target) bool {
+		return t.Kind == config.TargetStreams && matchStream(t.Pattern, node, ancestry)
+	})
+}
@@ -10,17 +10,23 @@ import (
 	"sync"
 	"time"
 
+	"github.com/omriharel/deej/config"
+	"github.com/omriharel/deej/pipewire"
+	"github.com/omriharel/deej/serial"
 	"github.com/omriharel/deej/session"
 	"github.com/rs/zerolog"
 )
 
 const (
-	maxValue = 1023.0
-	// noise margin for absolute value change.
-	noiseMargin            = 0.002
+	// largest value read by boards without adc_max or a handshake, 10 bit ADCs of most Arduinos.
+	defaultADCMax = 1023.0
+	// noise margins for absolute value change by noise reduction level.
+	noiseMarginLow         = 0.001
+	noiseMarginDefault     = 0.002
+	noiseMarginHigh        = 0.01
 	sessionVolumeInitDelay = 150 * time.Millisecond
-
-	targetUnmapped = "deej.unmapped"
+	// pw-dump reports volume changes with a delay, so volumes reported this long after writing them may be stale.
+	readbackDelay = 500 * time.Millisecond
 )
 
 type Slider struct {
@@ -29,8 +35,32 @@ type Slider struct {
 	parent *Sliders
 
 	value   float32
-	targets []string
+	targets []config.Target
 	sm      *session.Monitor
+
+	invert      bool
+	noiseMargin float64
+	curve       curve
+	limits      limits
+
+	filterConfig  config.Filter
+	filter        filter
+	writeInterval time.Duration
+
+	// signals the worker that value or targets changed, pending signals are coalesced.
+	changed chan struct{}
+	stop    context.CancelFunc
+
+	// last volume reported to the board, -1 if none.
+	reported      int
+	reportedMuted bool
+	// when the slider last wrote the volume of its targets, volumes reported until readbackDelay passed are its own.
+	written time.Time
+
+	// volume last applied by the worker, -1 if none, and the ids of the nodes its targets selected then.
+	// Only used by the worker.
+	applied      float32
+	appliedNodes map[int]bool
 }
 
 type Sliders struct {
@@ -39,40 +69,96 @@ type Sliders struct {
 	sliders []*Slider
 	sm      *session.Monitor
 
-	unmappedProcesses []string
+	// ids of output streams none of the sliders and encoders select by a matcher.
+	unmappedNodes map[int]bool
+
+	buttons  map[int]config.ButtonConfig
+	encoders map[int]*Encoder
+
+	// handshake of the connected board, nil if it did not send one.
+	handshake *serial.Handshake
+	// adc_max from the config, 0 if unset.
+	configADCMax float64
+
+	// whether a line with an unexpected number of values was reported since the last config change or handshake.
+	lineWarned bool
+
+	// pid of the process owning the focused window, 0 if unknown.
+	focusedPID int
+
+	volumeFuncs []func(ctx context.Context, idx, value int, muted bool)
 }
 
-func NewSliders(ctx context.Context, mapping [][]string, sm *session.Monitor) *Sliders {
+func NewSliders(ctx context.Context, cfg *config.Config, sm *session.Monitor) *Sliders {
 	logger := zerolog.Ctx(ctx)
 
 	sliders := &Sliders{
-		sliders: make([]*Slider, len(mapping)),
+		sliders: make([]*Slider, 0, len(cfg.SliderMapping)),
 		sm:      sm,
 
-		unmappedProcesses: make([]string, 0),
-	}
+		unmappedNodes: make(map[int]bool),
 
-	for i := range len(mapping) {
-		sliders.sliders[i] = &Slider{
-			parent: sliders,
+		buttons:  make(map[int]config.ButtonConfig),
+		encoders: make(map[int]*Encoder),
 
-			// set to -1 because it's an impossible value, so it will prompt a change on first read.
-			value:   -1,
-			targets: make([]string, 0),
-			sm:      sm,
-		}
+		handshake:    nil,
+		configADCMax: 0,
+
+		lineWarned: false,
+
+		focusedPID: 0,
+
+		volumeFuncs: make([]func(context.Context, int, int, bool), 0),
 	}
 
-	sliders.FromConfig(ctx, mapping)
+	sliders.FromConfig(ctx, cfg)
 
 	sliders.sm.OnUpdate(sliders.refreshUnmapped)
 	sliders.sm.OnUpdate(sliders.setVolumes)
+	sliders.sm.OnVolume(sliders.reportVolumes)
 
 	logger.Debug().Msg("Sliders initialized")
 
 	return sliders
 }
 
+// newSlider creates a slider whose worker runs until it is removed or ctx is done.
+func (s *Sliders) newSlider(ctx context.Context) *Slider {
+	ctx, cancel := context.WithCancel(ctx)
+
+	slider := &Slider{
+		parent: s,
+
+		// set to -1 because it's an impossible value, so it will prompt a change on first read.
+		value:   -1,
+		targets: make([]config.Target, 0),
+		sm:      s.sm,
+
+		invert:      false,
+		noiseMargin: noiseMarginDefault,
+		curve:       newCurve(config.Curve{}),
+		limits:      limits{deadZoneLow: 0, deadZoneHigh: 0, minPosition: 0, maxPosition: 1},
+
+		filterConfig:  config.Filter{},
+		filter:        newFilter(config.Filter{}),
+		writeInterval: 0,
+
+		changed: make(chan struct{}, 1),
+		stop:    cancel,
+
+		reported:      -1,
+		reportedMuted: false,
+		written:       time.Time{},
+
+		applied:      -1,
+		appliedNodes: make(map[int]bool),
+	}
+
+	go slider.run(ctx)
+
+	return slider
+}
+
 func (s *Sliders) HandleLine(ctx context.Context, line []byte) {
 	logger := zerolog.Ctx(ctx)
 
@@ -80,39 +166,58 @@ func (s *Sliders) HandleLine(ctx context.Context, line []byte) {
 
 	s.RLock()
 
-	sls := len(s.sliders)
+	// the config might be reloaded while handling the line.
+	sliders := s.sliders
+	handshake := s.handshake
+	adcMax := s.adcMax()
 
 	s.RUnlock()
 
-	if len(nvs) < sls {
-		return
-	}
+	sls := len(sliders)
 
-	for i, nv := range nvs {
-		if i >= sls {
-			break
-		}
+	switch {
+	case handshake != nil:
+		if len(nvs) != handshake.Sliders {
+			s.warnLine(ctx, len(nvs), handshake.Sliders, "Board sends a different number of values than it announced, ignoring its lines")
 
-		nvi, err := strconv.Atoi(strings.TrimSpace(string(nv)))
-		if err != nil {
 			return
 		}
+	case len(nvs) < sls:
+		s.warnLine(ctx, len(nvs), sls, "Board sends less values than slider_mapping has sliders, ignoring its lines")
+
+		return
+	}
+
+	values := make([]float32, 0, sls)
+
+	for _, nv := range nvs[:min(len(nvs), sls)] {
+		// some firmwares send decimals, i.e. percentages.
+		v, err := strconv.ParseFloat(strings.TrimSpace(string(nv)), 32)
+		// ParseFloat accepts "nan" and "inf", which would be written as volumes and stick in filters.
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			logger.Trace().Bytes("line", line).Msg("Ignoring malformed line")
 
-		if nvi > maxValue {
 			return
 		}
 
-		s.RLock()
+		// noisy readings may slightly overshoot the range.
+		values = append(values, float32(min(max(v/adcMax, 0), 1)))
+	}
 
-		slider := s.sliders[i]
+	for i, nvf := range values {
+		slider := sliders[i]
 
-		s.RUnlock()
+		slider.Lock()
 
-		nvf := float32(nvi) / maxValue
+		nvf = slider.filter(nvf)
 
-		slider.Lock()
+		if slider.invert {
+			nvf = 1 - nvf
+		}
+
+		nvf = float32(slider.limits.apply(float64(nvf)))
 
-		if math.Abs(float64(nvf-slider.value)) < noiseMargin {
+		if math.Abs(float64(nvf-slider.value)) < slider.noiseMargin {
 			slider.Unlock()
 
 			continue
@@ -123,76 +228,452 @@ func (s *Sliders) HandleLine(ctx context.Context, line []byte) {
 		logger.Debug().
 			Int("idx", i).
 			Float32("value", slider.value).
-			Strs("targets", slider.targets).
+			Strs("targets", targetNames(slider.targets)).
 			Msg("Slider value changed")
 
 		slider.Unlock()
 
-		go slider.handleValueChange(ctx)
+		slider.notify()
 	}
 }
 
-func (s *Slider) handleValueChange(ctx context.Context) {
+// OnVolume registers f to be called with the volume of the targets of a slider, scaled like the readings of the board,
+// whenever it changes other than by moving the slider, i.e. in a mixer or by an encoder.
+func (s *Sliders) OnVolume(f func(ctx context.Context, idx, value int, muted bool)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.volumeFuncs = append(s.volumeFuncs, f)
+}
+
+// ResendVolumes reports volumes of all sliders again, i.e. after the board was reconnected.
+func (s *Sliders) ResendVolumes(ctx context.Context) {
+	s.RLock()
+
+	for _, slider := range s.sliders {
+		slider.Lock()
+
+		slider.reported = -1
+
+		slider.Unlock()
+	}
+
+	s.RUnlock()
+
+	s.reportVolumes(ctx)
+}
+
+func (s *Sliders) warnLine(ctx context.Context, values, sliders int, msg string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.lineWarned {
+		return
+	}
+
+	s.lineWarned = true
+
+	zerolog.Ctx(ctx).Warn().
+		Int("values", values).
+		Int("sliders", sliders).
+		Msg(msg)
+}
+
+// SetFocused binds deej.current targets to the streams of the process pid and its children,
+// which are set to the volume of their sliders.
+func (s *Sliders) SetFocused(ctx context.Context, pid int) {
+	s.Lock()
+
+	if s.focusedPID == pid {
+		s.Unlock()
+
+		return
+	}
+
+	s.focusedPID = pid
+
+	s.Unlock()
+
+	zerolog.Ctx(ctx).Debug().Int("pid", pid).Msg("Focused window changed")
+
+	s.setVolumes(ctx)
+}
+
+// SetHandshake switches to the sliders and ADC resolution announced by the board,
+// or back to guessing them from its lines if handshake is nil.
+func (s *Sliders) SetHandshake(ctx context.Context, handshake *serial.Handshake) {
 	logger := zerolog.Ctx(ctx)
 
+	s.Lock()
+
+	if handshake == nil && s.handshake == nil {
+		s.Unlock()
+
+		return
+	}
+
+	s.handshake = handshake
+	s.lineWarned = false
+
+	// values are relative to the previous ADC resolution.
+	for _, slider := range s.sliders {
+		slider.Lock()
+
+		slider.value = -1
+		slider.reported = -1
+
+		slider.Unlock()
+	}
+
+	s.Unlock()
+
+	if handshake == nil {
+		logger.Debug().Msg("Handshake reset")
+
+		return
+	}
+
+	logger.Info().
+		Int("protocol", handshake.Protocol).
+		Int("sliders", handshake.Sliders).
+		Int("adc_max", handshake.ADCMax).
+		Int("buttons", handshake.Buttons).
+		Int("encoders", handshake.Encoders).
+		Msg("Board sent handshake")
+
+	if handshake.Protocol > serial.ProtocolVersion {
+		logger.Warn().
+			Int("protocol", handshake.Protocol).
+			Int("supported", serial.ProtocolVersion).
+			Msg("Board uses a newer protocol, features deej does not know are ignored")
+	}
+
+	s.checkMapping(ctx)
+	s.reportVolumes(ctx)
+}
+
+// checkMapping warns about mapped sliders, buttons and encoders the board does not have.
+func (s *Sliders) checkMapping(ctx context.Context) {
 	s.RLock()
 	defer s.RUnlock()
 
-	for _, target := range s.targets {
-		s.sm.RLock()
+	if s.handshake == nil {
+		return
+	}
 
-		for _, node := range s.sm.Nodes[target] {
-			err := node.SetVolume(ctx, s.value)
-			if err != nil {
-				logger.Error().Err(err).Str("binary", node.Binary).Msg("Failed to set volume")
-			}
+	logger := zerolog.Ctx(ctx)
+
+	if len(s.sliders) > s.handshake.Sliders {
+		logger.Warn().
+			Int("mapped", len(s.sliders)).
+			Int("sliders", s.handshake.Sliders).
+			Msg("slider_mapping has more sliders than the board, the extra ones are ignored")
+	}
+
+	for idx := range s.buttons {
+		if idx >= s.handshake.Buttons {
+			logger.Warn().
+				Int("idx", idx).
+				Int("buttons", s.handshake.Buttons).
+				Msg("buttons maps a button the board does not have")
 		}
+	}
+
+	for idx := range s.encoders {
+		if idx >= s.handshake.Encoders {
+			logger.Warn().
+				Int("idx", idx).
+				Int("encoders", s.handshake.Encoders).
+				Msg("encoders maps an encoder the board does not have")
+		}
+	}
+}
 
-		if target == targetUnmapped {
-			s.parent.RLock()
+// adcMax returns the largest value the board reads, it has to be called with the lock held.
+// adc_max from the config takes precedence over the handshake, in case the firmware announces it wrong.
+func (s *Sliders) adcMax() float64 {
+	switch {
+	case s.configADCMax > 0:
+		return s.configADCMax
+	case s.handshake != nil:
+		return float64(s.handshake.ADCMax)
+	default:
+		return defaultADCMax
+	}
+}
 
-			for _, process := range s.parent.unmappedProcesses {
-				for _, node := range s.sm.Nodes[process] {
-					err := node.SetVolume(ctx, s.value)
-					if err != nil {
-						logger.Error().Err(err).Str("binary", node.Binary).Msg("Failed to set volume")
-					}
-				}
+// notify makes the worker apply the current value, unless it is going to already.
+func (s *Slider) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run applies the latest value whenever it changes, at most once per write interval,
+// so that readings arriving in the meantime are coalesced and volumes are applied in order.
+func (s *Slider) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed:
+		}
+
+		s.handleValueChange(ctx)
+
+		s.RLock()
+
+		interval := s.writeInterval
+
+		s.RUnlock()
+
+		if interval <= 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *Slider) handleValueChange(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	s.RLock()
+
+	value := s.value
+	targets := s.targets
+	curve := s.curve
+
+	s.RUnlock()
+
+	// the slider has not been read yet.
+	if value < 0 {
+		return
+	}
+
+	// the only place slider positions are turned into volumes.
+	volume := float32(curve(float64(value)))
+
+	sel := s.parent.selection()
+
+	s.sm.RLock()
+	defer s.sm.RUnlock()
+
+	// unless the volume changed, only nodes that just started matching are written,
+	// so that volumes changed in mixers or by encoders are kept when streams come and go or change properties.
+	matched := make(map[int]bool)
+	nodes := make([]*pipewire.Node, 0)
+
+	for _, target := range targets {
+		for _, node := range s.parent.targetNodes(sel, target) {
+			if matched[node.ID] {
+				continue
 			}
 
-			s.parent.RUnlock()
+			matched[node.ID] = true
+
+			if volume != s.applied || !s.appliedNodes[node.ID] {
+				nodes = append(nodes, node)
+			}
 		}
+	}
+
+	s.applied = volume
+	s.appliedNodes = matched
 
-		s.sm.RUnlock()
+	if len(nodes) == 0 {
+		return
 	}
+
+	// volumes reported while and right after writing them are not sent back to the board.
+	s.markWritten()
+	defer s.markWritten()
+
+	for _, node := range nodes {
+		err := node.SetVolume(ctx, volume)
+		if err != nil {
+			logger.Error().Err(err).Str("binary", node.Binary).Str("name", node.Name).Msg("Failed to set volume")
+		}
+	}
+}
+
+func (s *Slider) markWritten() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.written = time.Now()
 }
 
-func (s *Sliders) FromConfig(ctx context.Context, userMapping [][]string) {
+// selection holds what deej.unmapped and deej.current targets select.
+type selection struct {
+	unmappedNodes map[int]bool
+	focusedPID    int
+}
+
+// selection has to be called before taking the session monitor lock,
+// which is always taken after the lock of the sliders, never before it.
+func (s *Sliders) selection() selection {
 	s.RLock()
+	defer s.RUnlock()
+
+	// unmappedNodes is replaced, never modified.
+	return selection{unmappedNodes: s.unmappedNodes, focusedPID: s.focusedPID}
+}
 
-	for i, targets := range userMapping {
-		if i >= len(s.sliders) {
-			break
+// targetNodes has to be called with the session monitor lock held.
+func (s *Sliders) targetNodes(sel selection, t config.Target) []*pipewire.Node {
+	switch t.Kind {
+	case config.TargetMasterDevice:
+		return deviceNodes(s.sm.Master)
+	case config.TargetMicDevice:
+		return deviceNodes(s.sm.Mic)
+	case config.TargetUnmappedStreams:
+		return streamNodes(s.sm.Nodes, func(node *pipewire.Node) bool {
+			return sel.unmappedNodes[node.ID]
+		})
+	case config.TargetCurrentStreams:
+		if sel.focusedPID == 0 {
+			return nil
 		}
 
+		return streamNodes(s.sm.Nodes, func(node *pipewire.Node) bool {
+			return slices.ContainsFunc(s.sm.Ancestry(node.ID), func(p session.Process) bool {
+				return p.PID == sel.focusedPID
+			})
+		})
+	case config.TargetInputs:
+		return streamNodes(s.sm.Inputs, s.matchStream(t))
+	default:
+		nodes := streamNodes(s.sm.Nodes, s.matchStream(t))
+
+		for _, device := range append(s.sm.Sinks(), s.sm.Sources()...) {
+			if matchDevice(t.Pattern, device) {
+				nodes = append(nodes, device)
+			}
+		}
+
+		return nodes
+	}
+}
+
+// matchStream returns a function matching streams by the pattern of t,
+// which has to be called with the session monitor lock held.
+func (s *Sliders) matchStream(t config.Target) func(node *pipewire.Node) bool {
+	return func(node *pipewire.Node) bool {
+		return matchStream(t.Pattern, node, s.sm.Ancestry(node.ID))
+	}
+}
+
+// streamNodes returns nodes of streams keyed by binary that match.
+func streamNodes(streams map[string]map[int]*pipewire.Node, match func(node *pipewire.Node) bool) []*pipewire.Node {
+	nodes := make([]*pipewire.Node, 0)
+
+	for _, nodesm := range streams {
+		for _, node := range nodesm {
+			if match(node) {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+
+	return nodes
+}
+
+func deviceNodes(node *pipewire.Node) []*pipewire.Node {
+	if node == nil {
+		return nil
+	}
+
+	return []*pipewire.Node{node}
+}
+
+// FromConfig applies targets and settings of cfg, adding or removing sliders to match its mapping.
+func (s *Sliders) FromConfig(ctx context.Context, cfg *config.Config) {
+	s.Lock()
+
+	for len(s.sliders) < len(cfg.SliderMapping) {
+		s.sliders = append(s.sliders, s.newSlider(ctx))
+	}
+
+	for _, slider := range s.sliders[len(cfg.SliderMapping):] {
+		slider.stop()
+	}
+
+	s.sliders = s.sliders[:len(cfg.SliderMapping)]
+	s.buttons = cfg.Buttons
+
+	// encoders are replaced as a whole, their workers are stopped with them.
+	for _, encoder := range s.encoders {
+		encoder.stop()
+	}
+
+	s.encoders = make(map[int]*Encoder, len(cfg.Encoders))
+
+	for idx := range cfg.Encoders {
+		s.encoders[idx] = newEncoder(ctx, cfg.Encoder(idx))
+	}
+
+	s.lineWarned = false
+
+	// the stored values are relative to the previous resolution, prompt a change on next read.
+	resetValues := s.configADCMax != cfg.ADCMax
+	s.configADCMax = cfg.ADCMax
+
+	for i, targets := range cfg.SliderMapping {
 		slider := s.sliders[i]
 
 		slider.Lock()
 
-		slider.targets = make([]string, 0, len(targets))
+		slider.targets = parseTargets(ctx, targets)
 
-		for _, target := range targets {
-			if target != "" {
-				slider.targets = append(slider.targets, target)
-			}
+		sc := cfg.Slider(i)
+		curve := newCurve(sc.Curve)
+		limits := newLimits(sc, curve)
+
+		// the stored value is already inverted and limited, prompt a change on next read.
+		if resetValues || slider.invert != *sc.Invert || slider.limits != limits {
+			slider.value = -1
 		}
 
+		slider.invert = *sc.Invert
+		slider.noiseMargin = noiseMargin(sc.NoiseReduction)
+		slider.curve = curve
+		slider.limits = limits
+		slider.writeInterval = cfg.MinWriteInterval
+
+		// keep the filter state unless its settings changed.
+		if slider.filterConfig != sc.Filter {
+			slider.filterConfig = sc.Filter
+			slider.filter = newFilter(sc.Filter)
+		}
+		// targets might have changed, report their volume again.
+		slider.reported = -1
+
 		slider.Unlock()
 	}
 
-	s.RUnlock()
+	s.Unlock()
 
+	s.checkMapping(ctx)
 	s.refreshUnmapped(ctx)
+	s.setVolumes(ctx)
+	s.reportVolumes(ctx)
+}
+
+func noiseMargin(level string) float64 {
+	switch level {
+	case config.NoiseReductionLow:
+		return noiseMarginLow
+	case config.NoiseReductionHigh:
+		return noiseMarginHigh
+	default:
+		return noiseMarginDefault
+	}
 }
 
 func (s *Sliders) refreshUnmapped(_ context.Context) {
@@ -201,44 +682,141 @@ func (s *Sliders) refreshUnmapped(_ context.Context) {
 	s.sm.RLock()
 	defer s.sm.RUnlock()
 
-	unmapped := make([]string, 0)
+	unmapped := make(map[int]bool)
 
-	for process := range s.sm.Nodes {
-		mapped := false
+	for _, node := range streamNodes(s.sm.Nodes, func(node *pipewire.Node) bool { return !s.mapped(node) }) {
+		unmapped[node.ID] = true
+	}
 
-		for _, slider := range s.sliders {
-			slider.RLock()
+	s.RUnlock()
 
-			if slices.Contains(slider.targets, process) {
-				mapped = true
+	s.Lock()
 
-				slider.RUnlock()
+	s.unmappedNodes = unmapped
 
-				break
-			}
+	s.Unlock()
+}
+
+// mapped reports whether any slider or encoder selects the output stream node by a matcher,
+// it has to be called with the lock and the session monitor lock held.
+func (s *Sliders) mapped(node *pipewire.Node) bool {
+	ancestry := s.sm.Ancestry(node.ID)
+
+	for _, slider := range s.sliders {
+		slider.RLock()
+
+		ok := matchesStream(slider.targets, node, ancestry)
+
+		slider.RUnlock()
+
+		if ok {
+			return true
+		}
+	}
+
+	// encoder targets never change, they are replaced on config changes.
+	for _, encoder := range s.encoders {
+		if matchesStream(encoder.targets, node, ancestry) {
+			return true
+		}
+	}
 
-			slider.RUnlock()
+	return false
+}
+
+func (s *Sliders) reportVolumes(ctx context.Context) {
+	s.RLock()
+
+	sliders := s.sliders
+	funcs := s.volumeFuncs
+	adcMax := s.adcMax()
+
+	s.RUnlock()
+
+	for i, slider := range sliders {
+		value, muted, ok := slider.targetVolume(adcMax)
+		if !ok {
+			continue
 		}
 
-		if !mapped {
-			unmapped = append(unmapped, process)
+		for _, f := range funcs {
+			f(ctx, i, value, muted)
 		}
 	}
+}
+
+// targetVolume returns the slider position matching the loudest volume of its targets in board scale,
+// and whether all of them are muted.
+// Returns false if none of the targets has a volume, it was already reported,
+// or it may still be the echo of a volume written by the slider itself.
+func (s *Slider) targetVolume(adcMax float64) (int, bool, bool) {
+	s.RLock()
+
+	targets := s.targets
+	invert := s.invert
+	curve := s.curve
+	limits := s.limits
+	written := s.written
 
 	s.RUnlock()
 
+	// reporting lagging echoes would move motorized faders back while they are being moved.
+	if time.Since(written) < readbackDelay {
+		return 0, false, false
+	}
+
+	volume := float32(-1)
+	muted := true
+
+	sel := s.parent.selection()
+
+	s.sm.RLock()
+
+	for _, target := range targets {
+		for _, node := range s.parent.targetNodes(sel, target) {
+			v, ok := s.sm.Volume(node.ID)
+			if !ok {
+				continue
+			}
+
+			volume = max(volume, v.Effective())
+			muted = muted && v.Muted
+		}
+	}
+
+	s.sm.RUnlock()
+
+	if volume < 0 {
+		return 0, false, false
+	}
+
+	position := limits.unapply(curve.inverse(float64(min(volume, 1))))
+
+	if invert {
+		position = 1 - position
+	}
+
+	value := int(math.Round(position * adcMax))
+
 	s.Lock()
+	defer s.Unlock()
+
+	if value == s.reported && muted == s.reportedMuted {
+		return 0, false, false
+	}
 
-	s.unmappedProcesses = unmapped
+	s.reported = value
+	s.reportedMuted = muted
 
-	s.Unlock()
+	return value, muted, true
 }
 
-func (s *Sliders) setVolumes(ctx context.Context) {
+// setVolumes makes the sliders apply their volume to the nodes their targets started selecting.
+func (s *Sliders) setVolumes(_ context.Context) {
 	s.RLock()
 	defer s.RUnlock()
 
 	for _, slider := range s.sliders {
-		go slider.handleValueChange(ctx)
+		slider.notify()
 	}
 }
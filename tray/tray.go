@@ -9,9 +9,20 @@ import (
 	"github.com/omriharel/deej/icon"
 )
 
+// Tray lets the running deej instance reflect its state in the tray.
+type Tray struct {
+	status *systray.MenuItem
+}
+
+// SetStatus shows status in the tray menu and tooltip.
+func (t *Tray) SetStatus(status string) {
+	t.status.SetTitle(status)
+	systray.SetTooltip("deej - " + status)
+}
+
 func InitializeTray(
 	ctx context.Context, cancel context.CancelFunc,
-	start func(context.Context, context.CancelFunc) error,
+	start func(context.Context, context.CancelFunc, *Tray) error,
 ) int {
 	exitCode := 0
 
@@ -24,6 +35,12 @@ func InitializeTray(
 		systray.SetTitle("deej")
 		systray.SetTooltip("deej")
 
+		t := &Tray{
+			status: systray.AddMenuItem("Starting", "Connection to the board"),
+		}
+
+		t.status.Disable()
+
 		systray.AddSeparator()
 		quit := systray.AddMenuItem("Quit", "Stop deej and quit")
 
@@ -42,7 +59,7 @@ func InitializeTray(
 			systray.Quit()
 		}()
 
-		err := start(ctx, cancel)
+		err := start(ctx, cancel, t)
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to run deej")
 